@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/analyze"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/spf13/cobra"
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze <history>",
+	Short: "Find the unavailability, stale reads and lost writes in a history recorded with --history",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteAnalyze(&cfg, prtr, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+	analyzeCmd.Flags().IntVar(&cfg.Examples, "examples", 10, "How many of the stale reads, lost writes and counterexamples to list")
+	analyzeCmd.Flags().StringVar(&cfg.Model, "model", "", fmt.Sprintf("Also check that the operations on every key are linearizable, for this model: %s or %s", analyze.Register.Name, analyze.Counter.Name))
+	analyzeCmd.Flags().DurationVar(&cfg.ModelTimeout, "model-timeout", time.Minute, "How long to spend checking linearizability, at most")
+}
+
+func ExecuteAnalyze(
+	config *config.RRConfig,
+	printer *printer.Printer,
+	path string,
+) error {
+	model, ok := analyze.Models[config.Model]
+	if config.Model != "" && !ok {
+		err := fmt.Errorf("unknown model %s; expected %s or %s", config.Model, analyze.Register.Name, analyze.Counter.Name)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.Examples < 0 {
+		err := fmt.Errorf("--examples can't be negative")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	ops, err := history.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	res := analyze.Analyze(ops)
+
+	if len(res.Windows) > 0 {
+		rows := []map[string]string{}
+		for _, w := range res.Windows {
+			rows = append(rows, map[string]string{
+				"start":    w.Start.String(),
+				"end":      w.End.String(),
+				"duration": (w.End - w.Start).String(),
+				"failed":   fmt.Sprint(w.Failed),
+			})
+		}
+		printer.Print(rows, []string{"start", "end", "duration", "failed"})
+	}
+
+	functions := []string{}
+	for f := range res.Latencies {
+		functions = append(functions, f)
+	}
+	slices.Sort(functions)
+	if len(functions) > 0 {
+		rows := []map[string]string{}
+		for _, f := range functions {
+			latencies := res.Latencies[f]
+			rows = append(rows, map[string]string{
+				"f":   f,
+				"ok":  fmt.Sprint(len(latencies)),
+				"p50": probe.Percentile(latencies, 50).String(),
+				"p90": probe.Percentile(latencies, 90).String(),
+				"p99": probe.Percentile(latencies, 99).String(),
+				"max": probe.Percentile(latencies, 100).String(),
+			})
+		}
+		printer.Print(rows, []string{"f", "ok", "p50", "p90", "p99", "max"})
+	}
+
+	if len(res.StaleReads)+len(res.LostWrites) > 0 {
+		rows := []map[string]string{}
+		for _, s := range res.StaleReads[:min(len(res.StaleReads), config.Examples)] {
+			rows = append(rows, map[string]string{
+				"anomaly":  "stale read",
+				"op":       s.Read.String(),
+				"evidence": s.Latest.String(),
+			})
+		}
+		for _, l := range res.LostWrites[:min(len(res.LostWrites), config.Examples)] {
+			rows = append(rows, map[string]string{
+				"anomaly":  "lost write",
+				"op":       l.Write.String(),
+				"evidence": l.Read.String(),
+			})
+		}
+		printer.Print(rows, []string{"anomaly", "op", "evidence"})
+	}
+
+	linearizable := ""
+	if config.Model != "" {
+		linearizable = printLinearizability(config, printer, analyze.Linearizable(ctx, model, res.Operations, config.ModelTimeout))
+	}
+
+	unavailable, longest := res.Unavailable()
+	printer.Itemise = true
+	summary := map[string]string{
+		"operations":     fmt.Sprint(len(res.Operations)),
+		"ok":             fmt.Sprint(res.Ok),
+		"fail":           fmt.Sprint(res.Fail),
+		"info":           fmt.Sprint(res.Info),
+		"processes":      fmt.Sprint(res.Processes),
+		"keys":           fmt.Sprint(res.Keys),
+		"duration":       res.Duration.String(),
+		"windows":        fmt.Sprint(len(res.Windows)),
+		"unavailable":    unavailable.String(),
+		"longest_window": longest.String(),
+		"stale_reads":    fmt.Sprint(len(res.StaleReads)),
+		"lost_writes":    fmt.Sprint(len(res.LostWrites)),
+	}
+	headers := []string{"operations", "ok", "fail", "info", "unavailable", "stale_reads", "lost_writes"}
+	if linearizable != "" {
+		summary["linearizable"] = linearizable
+		headers = append(headers, "linearizable")
+	}
+	printer.Print([]map[string]string{summary}, headers)
+	return nil
+}
+
+// prints the keys, and the counterexamples of the ones that aren't linearizable
+// returns true, false, or unknown when some keys couldn't be checked in time
+func printLinearizability(config *config.RRConfig, printer *printer.Printer, keys []*analyze.KeyLinearizability) string {
+	result := "true"
+	rows := []map[string]string{}
+	counterexamples := []map[string]string{}
+	shown := 0
+	for _, k := range keys {
+		linearizable := fmt.Sprint(k.Linearizable)
+		if !k.Checked {
+			linearizable = "unknown"
+			if result == "true" {
+				result = "unknown"
+			}
+		} else if !k.Linearizable {
+			result = "false"
+		}
+		rows = append(rows, map[string]string{
+			"key":          k.Key,
+			"operations":   fmt.Sprint(k.Operations),
+			"linearizable": linearizable,
+		})
+		if len(k.Counterexample) == 0 || shown >= config.Examples {
+			continue
+		}
+		shown++
+		for _, o := range k.Counterexample {
+			counterexamples = append(counterexamples, map[string]string{
+				"key": k.Key,
+				"op":  o.String(),
+			})
+		}
+	}
+	if len(rows) > 0 {
+		printer.Print(rows, []string{"key", "operations", "linearizable"})
+	}
+	if len(counterexamples) > 0 {
+		printer.Print(counterexamples, []string{"key", "op"})
+	}
+	return result
+}
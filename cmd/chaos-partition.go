@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/splitbrain"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var chaosPartitionCmd = &cobra.Command{
+	Use:   "partition",
+	Short: "Isolate the master with a NetworkPolicy for a while",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteChaosPartition(&cfg, prtr)
+	},
+}
+
+func init() {
+	chaosCmd.AddCommand(chaosPartitionCmd)
+	requiredPermissions["chaos partition"] = slices.Concat(
+		k8s.Permissions("", "pods", "get"),
+		k8s.Permissions("apps", "statefulsets", "get"),
+		k8s.Permissions("networking.k8s.io", "networkpolicies", "get", "list", "create", "update", "delete"),
+		lockPermissions,
+	)
+	chaosPartitionCmd.Flags().StringVar(&cfg.PartitionMode, "mode", k8s.PartitionSentinels, "What to isolate the master from ("+strings.Join(k8s.PartitionModes, ", ")+")")
+	chaosPartitionCmd.Flags().DurationVar(&cfg.PartitionDuration, "duration", 60*time.Second, "How long to hold the partition")
+	chaosPartitionCmd.Flags().DurationVar(&cfg.ObserveAfter, "observe", 30*time.Second, "How long to keep observing after the partition heals")
+	chaosPartitionCmd.Flags().StringVar(&cfg.SentinelSelector, "sentinel-selector", "", "Labels of the sentinel pods, like a=b,c=d. Defaults to the selector of the master's StatefulSet")
+	chaosPartitionCmd.Flags().DurationVar(&cfg.SplitBrainEvery, "split-brain-interval", 500*time.Millisecond, "How often to poll ROLE on every node to detect split brain")
+	addProbeFlags(chaosPartitionCmd)
+	addCollectFlags(chaosPartitionCmd)
+}
+
+func ExecuteChaosPartition(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+	events := &eventLog{}
+	pq, pqdone := printEvents(config, printer, start, events.sink)
+
+	// The plan here is:
+	// 1. read the master from sentinel, and find its pod
+	// 2. start watching the sentinel events, writing directly to the master
+	//    and polling the roles of all the nodes to detect split brain
+	// 3. create the NetworkPolicy isolating the master
+	// 4. hold it for the duration, then remove it
+	// 5. keep observing for a while, and summarise
+	//    including how many writes to the losing side of a split brain were lost
+	// 6. optionally, collect the logs and Kubernetes Events of the run
+	if err := checkProbeFlags(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		return err
+	}
+	commands := []string{"chaos partition"}
+	if config.Collect != "" {
+		commands = append(commands, "--collect")
+	}
+	clusters, err := getClusters(config, commands...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	primary := clusters.Primary()
+	lock, err := lockTarget(config, primary.Client, primary.Namespace, "chaos partition")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer releaseLock(lock)
+
+	// 1. Find the master pod, and who the sentinels are
+	oldMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	pq <- map[string]string{
+		"event": "initial master",
+		"msg":   fmt.Sprintf("%s:%s", oldMaster.Host, oldMaster.Port),
+	}
+	// the policy only isolates the master within its own cluster
+	cluster, name, err := clusters.ForHost(ctx, oldMaster.Host)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	k8sc, ns := cluster.Client, cluster.Namespace
+	pod, err := k8sc.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	collector, err := startCollecting(config, cluster, start)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if collector != nil {
+		if config.CollectSelector == "" {
+			config.CollectSelector = config.SentinelSelector
+		}
+		defer finishCollecting(config, clusters, cluster, collector, events, name)
+	}
+	var sentinels map[string]string
+	if config.SentinelSelector != "" {
+		sentinels, err = labels.ConvertSelectorToLabelsMap(config.SentinelSelector)
+	} else {
+		sts, e := k8s.GetStatefulSetForPod(ctx, k8sc, name, ns)
+		if e == nil {
+			sentinels = sts.Spec.Selector.MatchLabels
+		}
+		err = e
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	// like a StatefulSet selecting its pods with matchExpressions only
+	if len(sentinels) == 0 && config.PartitionMode != k8s.PartitionAll {
+		err := fmt.Errorf("no labels to tell the sentinels by; set --sentinel-selector")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	partition, err := k8s.NewPartition(k8sc, pod, sentinels, config.PartitionMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	nodes := []*redisClient.RedisInstance{oldMaster}
+	for _, r := range replicas {
+		nodes = append(nodes, &redisClient.RedisInstance{
+			Host:   r["ip"],
+			Port:   r["port"],
+			Master: config.SentinelMaster,
+		})
+	}
+	detector, err := splitbrain.NewDetector(config.RedisURL, nodes, "rr:split-brain", config.SplitBrainEvery)
+	if err != nil {
+		return err
+	}
+
+	// 2. Observe the sentinels, and the old master
+	octx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go redisClient.ForwardSentinelEvents(octx, rdbs, "*", pq)
+	opts, err := redisClient.MakeNodeOptions(config.RedisURL, oldMaster)
+	if err != nil {
+		return err
+	}
+	opts.ReadTimeout = config.ProbeTimeout
+	opts.WriteTimeout = config.ProbeTimeout
+	p := probe.NewProbe("old master", redis.NewClient(opts), config.ProbeKey, config.ProbeInterval, config.ProbeSlow)
+	if p.History, err = openHistory(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer closeHistory(p.History)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.Run(octx, pq)
+	}()
+	go func() {
+		defer wg.Done()
+		detector.Run(octx, pq)
+	}()
+
+	// 3. Partition, making sure to heal even when interrupted
+	sigctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// an earlier run killed before healing leaves its policies behind
+	err = partition.HealLeftovers(ctx, pq)
+	if err == nil {
+		err = partition.Apply(ctx, pq)
+	}
+	partitioned := time.Now()
+	if err == nil {
+		pq <- map[string]string{
+			"event": "partitioned",
+			"msg":   name,
+			"mode":  config.PartitionMode,
+		}
+		// 4. Hold it
+		select {
+		case <-sigctx.Done():
+			err = fmt.Errorf("interrupted")
+		case <-lock.Lost():
+			err = lock.Err()
+		case <-time.After(config.PartitionDuration):
+		}
+	}
+	if herr := partition.Heal(ctx, pq); herr != nil {
+		fmt.Fprintln(os.Stderr, herr)
+		if err == nil {
+			err = herr
+		}
+	}
+	healed := time.Now()
+	pq <- map[string]string{
+		"event": "healed",
+		"msg":   name,
+	}
+
+	// 5. See how it settles
+	if err == nil {
+		select {
+		case <-sigctx.Done():
+		case <-time.After(config.ObserveAfter):
+		}
+	}
+	cancel()
+	wg.Wait()
+	summary := p.Summary()
+	accepted, rejected := 0, 0
+	for _, r := range p.Results() {
+		if r.Op != "set" || r.Start.Before(partitioned) || r.Start.After(healed) {
+			continue
+		}
+		if r.Err == nil {
+			accepted++
+		} else {
+			rejected++
+		}
+	}
+	summary["event"] = "summary"
+	summary["writes_accepted"] = fmt.Sprint(accepted)
+	summary["writes_rejected"] = fmt.Sprint(rejected)
+	summary["partitioned"] = healed.Sub(partitioned).String()
+	newMaster, merr := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if merr == nil {
+		summary["final_master"] = fmt.Sprintf("%s:%s", newMaster.Host, newMaster.Port)
+		report, rerr := detector.Report(ctx, newMaster)
+		if rerr != nil {
+			fmt.Fprintln(os.Stderr, rerr)
+		}
+		for k, v := range report {
+			summary[k] = v
+		}
+	}
+	if err != nil {
+		summary["msg"] = err.Error()
+	}
+	summary["done"] = "true"
+	pq <- summary
+	<-pqdone
+	return err
+}
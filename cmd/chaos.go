@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var chaosCmd = &cobra.Command{
+	Use:   "chaos",
+	Short: "Inject failures into sentinel-managed redis on Kubernetes",
+}
+
+func init() {
+	rootCmd.AddCommand(chaosCmd)
+	addSentinelFlags(chaosCmd)
+}
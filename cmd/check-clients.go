@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+// the ways of connecting to redis compared by check clients
+const (
+	// go-redis FailoverClient, always talking to the master
+	strategyFailover = "failover"
+	// go-redis FailoverClusterClient, reading from the closest node
+	strategyRouteByLatency = "route-by-latency"
+	// go-redis FailoverClusterClient, reading from the replicas only
+	strategyReplicaOnly = "replica-only"
+	// a plain client pinned to the initial master, retrying on errors
+	strategyRetry = "retry"
+	// a plain client going through a Kubernetes Service, or any other address
+	strategyService = "service"
+)
+
+var clientStrategies = []string{strategyFailover, strategyRouteByLatency, strategyReplicaOnly, strategyRetry, strategyService}
+
+var checkClientsCmd = &cobra.Command{
+	Use:   "clients",
+	Short: "Run clients connecting in different ways side by side through a failover, and compare what they experienced",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteCheckClients(&cfg, prtr)
+	},
+}
+
+func init() {
+	checkCmd.AddCommand(checkClientsCmd)
+	addProbeFlags(checkClientsCmd)
+	checkClientsCmd.Flags().StringSliceVar(&cfg.Strategies, "strategies", []string{strategyFailover, strategyRouteByLatency, strategyReplicaOnly, strategyRetry}, fmt.Sprintf("Clients to run side by side. Any of %s. The service is added when --service is set", strings.Join(clientStrategies, ", ")))
+	checkClientsCmd.Flags().StringVar(&cfg.ServiceAddr, "service", "", "host:port of the Kubernetes Service (or any other proxy) in front of the master, for the service client")
+	checkClientsCmd.Flags().IntVar(&cfg.ClientRetries, "retries", 10, "How many times the retry client retries each command")
+	checkClientsCmd.Flags().DurationVar(&cfg.CheckDuration, "duration", 0, "Stop after this long. 0 to keep going until interrupted")
+	checkClientsCmd.Flags().DurationVar(&cfg.FailoverAfter, "failover-after", 0, "Ask the sentinel to failover this long after the start. 0 to leave the failover to something else")
+}
+
+func ExecuteCheckClients(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+
+	// The plan here is:
+	// 1. make a client for each of the strategies
+	// 2. run a probe with each, writing and reading back its own key
+	// 3. meanwhile, watch for failovers (triggered by --failover-after, sentinel kill, or anything else)
+	// 4. when done, put the probes side by side
+	if err := checkProbeFlags(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	strategies := slices.Clone(config.Strategies)
+	if config.ServiceAddr != "" && !slices.Contains(strategies, strategyService) {
+		strategies = append(strategies, strategyService)
+	}
+	for _, s := range strategies {
+		if !slices.Contains(clientStrategies, s) {
+			err := fmt.Errorf("unknown strategy %s; expected one of %s", s, strings.Join(clientStrategies, ", "))
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		if s == strategyService && config.ServiceAddr == "" {
+			err := fmt.Errorf("set --service for the %s strategy", strategyService)
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	master, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	// 1. Make the clients
+	recorder, err := openHistory(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer closeHistory(recorder)
+	probes := []*probe.Probe{}
+	for _, s := range strategies {
+		client, err := makeStrategyClient(config, s, master)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		defer client.Close()
+		p := probe.NewProbe(s, client, config.ProbeKey+":"+s, config.ProbeInterval, config.ProbeSlow)
+		p.History = recorder
+		probes = append(probes, p)
+	}
+
+	// 2. Probe
+	pq, pqdone := printEvents(config, printer, start)
+	rctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if config.CheckDuration > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(rctx, config.CheckDuration)
+		defer cancel()
+	}
+	pq <- map[string]string{
+		"event":      "probing",
+		"msg":        fmt.Sprintf("%s:%s", master.Host, master.Port),
+		"strategies": strings.Join(strategies, ","),
+	}
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Run(rctx, pq)
+		}()
+	}
+
+	// 3. Watch the failovers, and trigger one if asked to
+	failovers := make(chan *redisClient.RedisSwitchMasterEvent)
+	go redisClient.WatchSwitchMaster(rctx, rdbs, config.SentinelMaster, failovers, pq)
+	if config.FailoverAfter > 0 {
+		go func() {
+			select {
+			case <-rctx.Done():
+				return
+			case <-time.After(config.FailoverAfter):
+			}
+			if _, err := redisClient.Failover(rctx, rdbs, config.SentinelMaster); err != nil {
+				pq <- map[string]string{
+					"event": "failover failed",
+					"msg":   err.Error(),
+				}
+				return
+			}
+			pq <- map[string]string{
+				"event": "failover requested",
+				"msg":   config.SentinelMaster,
+			}
+		}()
+	}
+	count := 0
+	var switched time.Time
+	for running := true; running; {
+		select {
+		case evt := <-failovers:
+			count++
+			if switched.IsZero() {
+				switched = time.Now()
+			}
+			pq <- map[string]string{
+				"event": "failover",
+				"msg":   fmt.Sprintf("%s:%s -> %s:%s", evt.OldMasterHost, evt.OldMasterPort, evt.NewMasterHost, evt.NewMasterPort),
+			}
+		case <-rctx.Done():
+			running = false
+		}
+	}
+	wg.Wait()
+
+	// 4. Compare
+	rows := []map[string]string{}
+	for _, p := range probes {
+		summary := p.Summary()
+		summary["event"] = "client probe"
+		summary["msg"] = fmt.Sprintf("%s errors, unavailable for %s", summary["errors"], summary["unavailable"])
+		// how long after the first failover the client managed to write again
+		summary["first_write_after_failover"] = "-"
+		if !switched.IsZero() {
+			summary["first_write_after_failover"] = "none"
+			if r, ok := p.FirstSuccess("set", "", switched); ok {
+				summary["first_write_after_failover"] = r.Start.Add(r.Latency).Sub(switched).String()
+			}
+		}
+		pq <- summary
+		rows = append(rows, summary)
+	}
+	pq <- map[string]string{
+		"done":      "true",
+		"event":     "summary",
+		"msg":       fmt.Sprintf("%d clients through %d failovers", len(probes), count),
+		"failovers": fmt.Sprint(count),
+	}
+	<-pqdone
+	printer.SkipHeaders = false
+	printer.Itemise = false
+	printer.Print(rows, []string{"probe", "errors", "unavailable", "longest_window", "first_write_after_failover", "errors_readonly", "errors_connection_refused", "errors_timeout", "stale_reads", "p99"})
+	return nil
+}
+
+// a client connecting in the given way
+func makeStrategyClient(config *config.RRConfig, strategy string, master *redisClient.RedisInstance) (redis.UniversalClient, error) {
+	switch strategy {
+	case strategyFailover, strategyRouteByLatency, strategyReplicaOnly:
+		opts, err := redisClient.MakeFailoverOptions(config.SentinelURL, config.RedisURL, config.SentinelMaster)
+		if err != nil {
+			return nil, err
+		}
+		opts.ReadTimeout = config.ProbeTimeout
+		opts.WriteTimeout = config.ProbeTimeout
+		if strategy == strategyFailover {
+			return redis.NewFailoverClient(opts), nil
+		}
+		// the writes still go to the master, only the reads are routed
+		opts.RouteByLatency = strategy == strategyRouteByLatency
+		opts.ReplicaOnly = strategy == strategyReplicaOnly
+		return redis.NewFailoverClusterClient(opts), nil
+	}
+	node := master
+	if strategy == strategyService {
+		host, port, err := net.SplitHostPort(config.ServiceAddr)
+		if err != nil {
+			return nil, fmt.Errorf("bad --service %q; got %s", config.ServiceAddr, err)
+		}
+		node = &redisClient.RedisInstance{Host: host, Port: port}
+	}
+	opts, err := redisClient.MakeNodeOptions(config.RedisURL, node)
+	if err != nil {
+		return nil, err
+	}
+	opts.ReadTimeout = config.ProbeTimeout
+	opts.WriteTimeout = config.ProbeTimeout
+	if strategy == strategyRetry {
+		opts.MaxRetries = config.ClientRetries
+	}
+	return redis.NewClient(opts), nil
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/check"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+var checkStaleReadsCmd = &cobra.Command{
+	Use:   "stale-reads",
+	Short: "Write to the master and read back from the replicas, to see how often the reads are stale",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteCheckStaleReads(&cfg, prtr)
+	},
+}
+
+func init() {
+	checkCmd.AddCommand(checkStaleReadsCmd)
+	checkStaleReadsCmd.Flags().IntVar(&cfg.Clients, "clients", 100, "Number of concurrent clients, each with its own key")
+	checkStaleReadsCmd.Flags().IntVar(&cfg.Operations, "operations", 1000, "Number of writes per client. 0 to keep going for the --duration")
+	checkStaleReadsCmd.Flags().DurationVar(&cfg.CheckDuration, "duration", 0, "Stop after this long, even if the clients aren't done. 0 for no limit")
+	checkStaleReadsCmd.Flags().StringVar(&cfg.KeyPrefix, "key-prefix", "rr:stale-reads:", "Prefix of the keys the clients write to. They're deleted afterwards")
+	checkStaleReadsCmd.Flags().StringSliceVar(&cfg.ReadFrom, "read-from", []string{"replicas"}, "Where to read from: replicas (the clients spread across the replicas the sentinel knows), all (every client reads from every replica), or a list of host:port")
+	checkStaleReadsCmd.Flags().StringVar(&cfg.WriteTo, "write-to", "", "host:port of the master to write to, instead of asking the sentinel. Needs --read-from host:port")
+}
+
+func parseHostPort(addr string) (*redisClient.RedisInstance, error) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("bad address %q; expected host:port", addr)
+	}
+	return &redisClient.RedisInstance{Host: addr[:i], Port: addr[i+1:]}, nil
+}
+
+// the replicas to read from, and whether every client reads from all of them
+func staleReadsReaders(config *config.RRConfig, rdbs *redis.Client) ([]*check.Reader, bool, error) {
+	nodes := []*redisClient.RedisInstance{}
+	readAll := false
+	if len(config.ReadFrom) == 1 && (config.ReadFrom[0] == "replicas" || config.ReadFrom[0] == "all") {
+		if rdbs == nil {
+			return nil, false, fmt.Errorf("--read-from %s needs the sentinel; with --write-to, list the replicas as host:port", config.ReadFrom[0])
+		}
+		readAll = config.ReadFrom[0] == "all"
+		replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, config.SentinelMaster)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, r := range replicas {
+			if strings.Contains(r["flags"], "down") || strings.Contains(r["flags"], "disconnected") {
+				continue
+			}
+			nodes = append(nodes, &redisClient.RedisInstance{Host: r["ip"], Port: r["port"]})
+		}
+	} else {
+		for _, addr := range config.ReadFrom {
+			node, err := parseHostPort(addr)
+			if err != nil {
+				return nil, false, fmt.Errorf("bad --read-from %q; expected replicas, all, or host:port", addr)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, false, fmt.Errorf("no replicas to read from")
+	}
+	slices.SortFunc(nodes, func(a, b *redisClient.RedisInstance) int {
+		return strings.Compare(a.Host+":"+a.Port, b.Host+":"+b.Port)
+	})
+	readers := []*check.Reader{}
+	for _, n := range nodes {
+		opts, err := redisClient.MakeNodeOptions(config.RedisURL, n)
+		if err != nil {
+			return nil, false, err
+		}
+		opts.PoolSize = config.Clients
+		readers = append(readers, &check.Reader{
+			Name:   fmt.Sprintf("%s:%s", n.Host, n.Port),
+			Client: redis.NewClient(opts),
+		})
+	}
+	return readers, readAll, nil
+}
+
+func ExecuteCheckStaleReads(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	// The plan here is:
+	// 1. find the master and the replicas to read from, through the sentinel unless given
+	// 2. every client writes an increasing version to its own key on the master,
+	//    and right after reads it back from the replica(s)
+	// 3. summarise per client, overall, and how stale the stale reads were
+	if config.Operations <= 0 && config.CheckDuration <= 0 {
+		err := fmt.Errorf("set --operations, --duration, or both")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.Clients <= 0 || config.Operations < 0 || config.CheckDuration < 0 {
+		err := fmt.Errorf("--clients needs to be positive, and --operations and --duration can't be negative")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	var rdbs *redis.Client
+	var master *redisClient.RedisInstance
+	var err error
+	if config.WriteTo != "" {
+		if master, err = parseHostPort(config.WriteTo); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+	} else {
+		if rdbs, err = redisClient.MakeRedisClient(config.SentinelURL); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		defer rdbs.Close()
+		if master, err = redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+	}
+	opts, err := redisClient.MakeNodeOptions(config.RedisURL, master)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	opts.PoolSize = config.Clients
+	writer := redis.NewClient(opts)
+	defer writer.Close()
+	readers, readAll, err := staleReadsReaders(config, rdbs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	for _, r := range readers {
+		defer r.Client.Close()
+	}
+
+	// 2. Hammer it
+	sr := &check.StaleReads{
+		Writer:     writer,
+		Readers:    readers,
+		Clients:    config.Clients,
+		Operations: config.Operations,
+		KeyPrefix:  config.KeyPrefix,
+		ReadAll:    readAll,
+	}
+	rctx := ctx
+	if config.CheckDuration > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(ctx, config.CheckDuration)
+		defer cancel()
+	}
+	start := time.Now()
+	results, err := sr.Run(rctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	elapsed := time.Since(start)
+	if err := sr.Cleanup(ctx, results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	// 3. Summarise
+	rows := []map[string]string{}
+	total := &check.StaleReadsResult{Behind: map[int64]int{}}
+	for _, r := range results {
+		rows = append(rows, map[string]string{
+			"client":     r.Client,
+			"read_from":  strings.Join(r.Readers, ","),
+			"writes":     fmt.Sprint(r.Writes),
+			"reads":      fmt.Sprint(r.Reads),
+			"stale":      fmt.Sprint(r.Stale),
+			"stale_rate": fmt.Sprintf("%.4f", r.StaleRate()),
+			"max_behind": fmt.Sprint(r.MaxBehind),
+			"errors":     fmt.Sprint(r.Errors),
+		})
+		total.Writes += r.Writes
+		total.Reads += r.Reads
+		total.Stale += r.Stale
+		total.Errors += r.Errors
+		total.MaxBehind = max(total.MaxBehind, r.MaxBehind)
+		for behind, n := range r.Behind {
+			total.Behind[behind] += n
+		}
+	}
+	printer.Print(rows, []string{"client", "read_from", "writes", "reads", "stale", "stale_rate", "max_behind", "errors"})
+
+	histogram := []map[string]string{}
+	for _, b := range check.StalenessHistogram(total.Behind) {
+		histogram = append(histogram, map[string]string{
+			"versions_behind": b.Name,
+			"reads":           fmt.Sprint(b.Reads),
+			"share":           fmt.Sprintf("%.4f", float64(b.Reads)/float64(max(total.Reads, 1))),
+		})
+	}
+	if len(histogram) > 0 {
+		printer.Print(histogram, []string{"versions_behind", "reads", "share"})
+	}
+
+	printer.Itemise = true
+	printer.Print([]map[string]string{{
+		"clients":          fmt.Sprint(config.Clients),
+		"master":           fmt.Sprintf("%s:%s", master.Host, master.Port),
+		"writes":           fmt.Sprint(total.Writes),
+		"reads":            fmt.Sprint(total.Reads),
+		"stale":            fmt.Sprint(total.Stale),
+		"stale_rate":       fmt.Sprintf("%.4f", total.StaleRate()),
+		"max_behind":       fmt.Sprint(total.MaxBehind),
+		"errors":           fmt.Sprint(total.Errors),
+		"duration":         elapsed.String(),
+		"reads_per_second": fmt.Sprintf("%.1f", float64(total.Reads)/elapsed.Seconds()),
+	}}, []string{"writes", "reads", "stale", "stale_rate", "max_behind", "errors", "duration"})
+	return nil
+}
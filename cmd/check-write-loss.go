@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/check"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+var checkWriteLossCmd = &cobra.Command{
+	Use:   "write-loss",
+	Short: "Keep writing through failovers, and report which acknowledged writes were lost",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteCheckWriteLoss(&cfg, prtr)
+	},
+}
+
+func init() {
+	checkCmd.AddCommand(checkWriteLossCmd)
+	checkWriteLossCmd.Flags().IntVar(&cfg.LossClients, "clients", 10, "Number of concurrent clients, each appending to its own list")
+	checkWriteLossCmd.Flags().DurationVar(&cfg.CheckDuration, "duration", 0, "Stop writing after this long. 0 to keep going until interrupted")
+	checkWriteLossCmd.Flags().DurationVar(&cfg.LossInterval, "interval", 10*time.Millisecond, "Pause between the writes of each client")
+	checkWriteLossCmd.Flags().StringVar(&cfg.LossKeyPrefix, "key-prefix", "rr:write-loss:", "Prefix of the lists the clients write to. They're deleted afterwards")
+	checkWriteLossCmd.Flags().DurationVar(&cfg.VerifyTimeout, "verify-timeout", 60*time.Second, "How long to keep trying to read the writes back, while the master settles")
+	checkWriteLossCmd.Flags().StringSliceVar(&cfg.LossModes, "modes", []string{check.ModeAsync}, fmt.Sprintf("Modes to run one after the other, for --duration each, and compare. One or more of %s", strings.Join(check.WriteLossModes, ", ")))
+	checkWriteLossCmd.Flags().DurationVar(&cfg.FailoverAfter, "failover-after", 0, "Ask the sentinel to failover this long into each mode. 0 to leave the failovers to something else")
+	checkWriteLossCmd.Flags().IntVar(&cfg.WaitReplicas, "wait-replicas", 1, "In the wait mode, how many replicas must confirm each write")
+	checkWriteLossCmd.Flags().DurationVar(&cfg.WaitTimeout, "wait-timeout", 100*time.Millisecond, "In the wait mode, how long to WAIT for the replicas after each write")
+	checkWriteLossCmd.Flags().IntVar(&cfg.MinReplicas, "min-replicas", 1, "In the min-replicas mode, min-replicas-to-write to set on the nodes")
+	checkWriteLossCmd.Flags().DurationVar(&cfg.MinReplicasMaxLag, "min-replicas-max-lag", 10*time.Second, "In the min-replicas mode, min-replicas-max-lag to set on the nodes")
+}
+
+func ExecuteCheckWriteLoss(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+
+	// The plan here is:
+	// 1. for each mode, keep appending increasing numbers to a list per client, through a sentinel-aware client
+	//    remembering which writes the master acknowledged
+	// 2. meanwhile, count the failovers (triggered by sentinel kill, --failover-after, or anything else)
+	// 3. when done, read the lists back from the master, and compare
+	// 4. with more than one mode, put them side by side
+	for _, mode := range config.LossModes {
+		if !slices.Contains(check.WriteLossModes, mode) {
+			err := fmt.Errorf("unknown mode %s; expected one of %s", mode, strings.Join(check.WriteLossModes, ", "))
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+	}
+	if len(config.LossModes) > 1 && config.CheckDuration <= 0 {
+		err := fmt.Errorf("set --duration to compare modes")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	// WAIT with a timeout of 0 blocks until enough replicas confirm, forever when they're gone
+	if slices.Contains(config.LossModes, check.ModeWait) && (config.WaitReplicas < 0 || config.WaitTimeout < time.Millisecond) {
+		err := fmt.Errorf("--wait-replicas can't be negative, and --wait-timeout needs to be at least 1ms")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	// redis takes the lag in whole seconds
+	if slices.Contains(config.LossModes, check.ModeMinReplicas) && (config.MinReplicas < 0 || config.MinReplicasMaxLag < time.Second || config.MinReplicasMaxLag%time.Second != 0) {
+		err := fmt.Errorf("--min-replicas can't be negative, and --min-replicas-max-lag needs to be a whole number of seconds, at least 1s")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	opts, err := redisClient.MakeFailoverOptions(config.SentinelURL, config.RedisURL, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	// a retried write could be applied twice, and it's the first attempt that counts
+	opts.MaxRetries = -1
+	opts.PoolSize = config.LossClients
+	client := redis.NewFailoverClient(opts)
+	defer client.Close()
+
+	pq, pqdone := printEvents(config, printer, start)
+	rctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runs := []*writeLossRun{}
+	for i, mode := range config.LossModes {
+		run, err := runWriteLoss(rctx, config, rdbs, client, mode, pq)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			pq <- map[string]string{
+				"done":  "true",
+				"event": "failed",
+				"msg":   err.Error(),
+				"mode":  mode,
+			}
+			<-pqdone
+			return err
+		}
+		runs = append(runs, run)
+		summary := run.Summary()
+		// interrupted, skip the remaining modes
+		if i == len(config.LossModes)-1 || rctx.Err() != nil {
+			summary["done"] = "true"
+			pq <- summary
+			break
+		}
+		pq <- summary
+	}
+	<-pqdone
+
+	// 4. Compare
+	if len(runs) < 2 {
+		return nil
+	}
+	rows := []map[string]string{}
+	for _, run := range runs {
+		rows = append(rows, run.Summary())
+	}
+	printer.SkipHeaders = false
+	printer.Itemise = false
+	printer.Print(rows, []string{"mode", "acked", "failed", "lost", "loss_rate", "latency_p50", "latency_p99", "latency_max", "failovers"})
+	return nil
+}
+
+// the outcome of writing in one of the modes
+type writeLossRun struct {
+	Mode      string
+	Results   []*check.WriteLossResult
+	Failovers int
+	Writing   time.Duration
+}
+
+// writes in the given mode until the context is done, or for --duration, and reads it all back
+func runWriteLoss(
+	rctx context.Context,
+	config *config.RRConfig,
+	rdbs *redis.Client,
+	client redis.UniversalClient,
+	mode string,
+	pq chan map[string]string,
+) (*writeLossRun, error) {
+	master, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		return nil, err
+	}
+	wl := &check.WriteLoss{
+		Client:    client,
+		Clients:   config.LossClients,
+		KeyPrefix: config.LossKeyPrefix + mode + ":",
+		Interval:  config.LossInterval,
+	}
+	switch mode {
+	case check.ModeWait:
+		wl.WaitReplicas = config.WaitReplicas
+		wl.WaitTimeout = config.WaitTimeout
+	case check.ModeMinReplicas:
+		restore, err := setMinReplicas(config, rdbs, master, pq)
+		if err != nil {
+			return nil, err
+		}
+		defer restore()
+	}
+
+	// 1. & 2. Write until told to stop
+	var wctx context.Context
+	var cancel context.CancelFunc
+	if config.CheckDuration > 0 {
+		wctx, cancel = context.WithTimeout(rctx, config.CheckDuration)
+	} else {
+		wctx, cancel = context.WithCancel(rctx)
+	}
+	defer cancel()
+	failovers := make(chan *redisClient.RedisSwitchMasterEvent)
+	go func() {
+		redisClient.WatchSwitchMaster(wctx, rdbs, config.SentinelMaster, failovers, pq)
+		close(failovers)
+	}()
+	// read once counted, which is once the watcher is done
+	count := 0
+	counted := make(chan bool)
+	go func() {
+		defer close(counted)
+		for evt := range failovers {
+			count++
+			pq <- map[string]string{
+				"event": "failover",
+				"msg":   fmt.Sprintf("%s:%s -> %s:%s", evt.OldMasterHost, evt.OldMasterPort, evt.NewMasterHost, evt.NewMasterPort),
+				"mode":  mode,
+			}
+		}
+	}()
+	if config.FailoverAfter > 0 {
+		go func() {
+			select {
+			case <-wctx.Done():
+				return
+			case <-time.After(config.FailoverAfter):
+			}
+			if _, err := redisClient.Failover(wctx, rdbs, config.SentinelMaster); err != nil {
+				pq <- map[string]string{
+					"event": "failover failed",
+					"msg":   err.Error(),
+					"mode":  mode,
+				}
+				return
+			}
+			pq <- map[string]string{
+				"event": "failover requested",
+				"msg":   config.SentinelMaster,
+				"mode":  mode,
+			}
+		}()
+	}
+	pq <- map[string]string{
+		"event":   "writing",
+		"msg":     fmt.Sprintf("%s:%s", master.Host, master.Port),
+		"mode":    mode,
+		"clients": fmt.Sprint(config.LossClients),
+	}
+	start := time.Now()
+	wl.Run(wctx, pq)
+	cancel()
+	writing := time.Since(start)
+	<-counted
+	pq <- map[string]string{
+		"event": "stopped writing",
+		"msg":   writing.String(),
+		"mode":  mode,
+	}
+
+	// 3. Read it all back, once the master is reachable
+	vctx, vcancel := context.WithTimeout(ctx, config.VerifyTimeout)
+	defer vcancel()
+	var results []*check.WriteLossResult
+	for {
+		results, err = wl.Verify(vctx)
+		if err == nil || vctx.Err() != nil {
+			break
+		}
+		pq <- map[string]string{
+			"debug": "true",
+			"event": "verify failed",
+			"msg":   err.Error(),
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't verify the writes; got %s", err)
+	}
+	if err := wl.Cleanup(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	for _, r := range results {
+		if len(r.Lost) == 0 {
+			continue
+		}
+		pq <- map[string]string{
+			"event":             "lost writes",
+			"msg":               check.FormatRanges(r.Lost),
+			"mode":              mode,
+			"client":            r.Client,
+			"key":               r.Key,
+			"lost":              fmt.Sprint(len(r.Lost)),
+			"loss_window_start": r.FirstLost.Format(time.RFC3339Nano),
+			"loss_window_end":   r.LastLost.Format(time.RFC3339Nano),
+		}
+	}
+	return &writeLossRun{
+		Mode:      mode,
+		Results:   results,
+		Failovers: count,
+		Writing:   writing,
+	}, nil
+}
+
+// sets min-replicas-to-write and min-replicas-max-lag on the master and the replicas,
+// so that they stay in place after a failover, and returns how to put the previous values back
+// unreachable replicas are skipped, but the master has to take it
+func setMinReplicas(
+	config *config.RRConfig,
+	rdbs *redis.Client,
+	master *redisClient.RedisInstance,
+	pq chan map[string]string,
+) (func(), error) {
+	nodes := []*redisClient.RedisInstance{master}
+	replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range replicas {
+		nodes = append(nodes, &redisClient.RedisInstance{
+			Host:   r["ip"],
+			Port:   r["port"],
+			Master: config.SentinelMaster,
+		})
+	}
+	previous := map[*redisClient.RedisInstance]map[string]string{}
+	restore := func() {
+		for node, values := range previous {
+			if err := setNodeConfig(config, node, values); err != nil {
+				pq <- map[string]string{
+					"event": "restore failed",
+					"msg":   err.Error(),
+					"node":  fmt.Sprintf("%s:%s", node.Host, node.Port),
+				}
+				continue
+			}
+			pq <- map[string]string{
+				"debug": "true",
+				"event": "restored",
+				"msg":   fmt.Sprintf("%s:%s", node.Host, node.Port),
+			}
+		}
+	}
+	values := map[string]string{
+		"min-replicas-to-write": fmt.Sprint(config.MinReplicas),
+		"min-replicas-max-lag":  fmt.Sprint(int(config.MinReplicasMaxLag.Seconds())),
+	}
+	set := 0
+	for i, node := range nodes {
+		rdb, err := redisClient.MakeNodeClient(config.RedisURL, node)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		current, err := rdb.ConfigGet(ctx, "min-replicas-*").Result()
+		rdb.Close()
+		if err == nil {
+			// before setting anything, so that a partial set is put back too
+			previous[node] = map[string]string{
+				"min-replicas-to-write": current["min-replicas-to-write"],
+				"min-replicas-max-lag":  current["min-replicas-max-lag"],
+			}
+			err = setNodeConfig(config, node, values)
+		}
+		if err != nil && i == 0 {
+			restore()
+			return nil, fmt.Errorf("can't set min-replicas on the master %s:%s; got %s", node.Host, node.Port, err)
+		}
+		if err != nil {
+			pq <- map[string]string{
+				"event": "skipped replica",
+				"msg":   err.Error(),
+				"node":  fmt.Sprintf("%s:%s", node.Host, node.Port),
+			}
+			continue
+		}
+		set++
+	}
+	pq <- map[string]string{
+		"event":                 "min-replicas set",
+		"msg":                   fmt.Sprintf("%d nodes", set),
+		"min-replicas-to-write": values["min-replicas-to-write"],
+		"min-replicas-max-lag":  values["min-replicas-max-lag"],
+	}
+	return restore, nil
+}
+
+func setNodeConfig(config *config.RRConfig, node *redisClient.RedisInstance, values map[string]string) error {
+	rdb, err := redisClient.MakeNodeClient(config.RedisURL, node)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	for k, v := range values {
+		if err := rdb.ConfigSet(ctx, k, v).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the totals over all the clients
+func (r *writeLossRun) Summary() map[string]string {
+	total := &check.WriteLossResult{}
+	for _, res := range r.Results {
+		total.Writes += res.Writes
+		total.Acked += res.Acked
+		total.Failed += res.Failed
+		total.UnackedPresent += res.UnackedPresent
+		total.Lost = append(total.Lost, res.Lost...)
+		total.Latencies = append(total.Latencies, res.Latencies...)
+		if !res.FirstLost.IsZero() && (total.FirstLost.IsZero() || res.FirstLost.Before(total.FirstLost)) {
+			total.FirstLost = res.FirstLost
+		}
+		if res.LastLost.After(total.LastLost) {
+			total.LastLost = res.LastLost
+		}
+	}
+	summary := map[string]string{
+		"event":           "summary",
+		"msg":             fmt.Sprintf("lost %d of %d acknowledged writes", len(total.Lost), total.Acked),
+		"mode":            r.Mode,
+		"writes":          fmt.Sprint(total.Writes),
+		"acked":           fmt.Sprint(total.Acked),
+		"failed":          fmt.Sprint(total.Failed),
+		"lost":            fmt.Sprint(len(total.Lost)),
+		"loss_rate":       fmt.Sprintf("%.6f", total.LossRate()),
+		"unacked_present": fmt.Sprint(total.UnackedPresent),
+		"latency_p50":     probe.Percentile(total.Latencies, 50).String(),
+		"latency_p99":     probe.Percentile(total.Latencies, 99).String(),
+		"latency_max":     probe.Percentile(total.Latencies, 100).String(),
+		"failovers":       fmt.Sprint(r.Failovers),
+		"writing":         r.Writing.String(),
+	}
+	if !total.FirstLost.IsZero() {
+		summary["loss_window_start"] = total.FirstLost.Format(time.RFC3339Nano)
+		summary["loss_window_end"] = total.LastLost.Format(time.RFC3339Nano)
+		summary["loss_window"] = total.LastLost.Sub(total.FirstLost).String()
+	}
+	return summary
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Measure the consistency guarantees of your redis setup",
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	addSentinelFlags(checkCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var kubeManifestCmd = &cobra.Command{
+	Use:   "manifest -- [rr command and flags]",
+	Short: "Print a Job or CronJob running rr in the cluster, with its RBAC",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteKubeManifest(&cfg, prtr, args)
+	},
+}
+
+func init() {
+	kubeCmd.AddCommand(kubeManifestCmd)
+	kubeManifestCmd.Flags().StringVar(&cfg.RBACName, "name", "rr", "Name of the Job/CronJob, ServiceAccount, Role and RoleBinding")
+	kubeManifestCmd.Flags().StringVar(&cfg.Image, "image", "", "rr image to run. Defaults to the version of this rr")
+	kubeManifestCmd.Flags().StringVar(&cfg.Schedule, "schedule", "", "Cron schedule, like \"0 10 * * 2\". Makes a CronJob instead of a Job")
+	kubeManifestCmd.Flags().StringVar(&cfg.Secret, "secret", "", "Existing Secret with the "+CMD_PREFIX+"SENTINEL_URL and "+CMD_PREFIX+"REDIS_URL keys. By default, one is generated from --sentinel and --redis")
+}
+
+// the commands in requiredPermissions used by the args
+// like "sentinel kill" and "sentinel kill --with-pvc" for [sentinel kill --with-pvc -t 5m]
+func commandsInArgs(args []string) []string {
+	// the flags can also come as --collect=dir
+	words := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			arg, _, _ = strings.Cut(arg, "=")
+		}
+		words = append(words, arg)
+	}
+	commands := []string{}
+	for c := range requiredPermissions {
+		used := true
+		for _, word := range strings.Split(c, " ") {
+			used = used && slices.Contains(words, word)
+		}
+		if used {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+func ExecuteKubeManifest(
+	config *config.RRConfig,
+	printer *printer.Printer,
+	args []string,
+) error {
+	ns, err := k8s.DeriveNamespace(config.Namespace, config.Kubeconfig, config.Context)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	image := config.Image
+	if image == "" {
+		image = "seeker89/redis-reliability:latest"
+		if Version != "" {
+			image = "seeker89/redis-reliability:" + Version
+		}
+	}
+	perms := []k8s.Permission{}
+	if commands := commandsInArgs(args); len(commands) > 0 {
+		var err error
+		perms, err = permissionsFor(commands)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+	}
+	env := map[string]string{
+		CMD_PREFIX + "SENTINEL_MASTER": config.SentinelMaster,
+	}
+	// the URLs can have passwords in them, so they go in a Secret, rather than the Job
+	urls := map[string]string{}
+	if config.SentinelURL != "" {
+		urls[CMD_PREFIX+"SENTINEL_URL"] = config.SentinelURL
+	}
+	if config.RedisURL != "" {
+		urls[CMD_PREFIX+"REDIS_URL"] = config.RedisURL
+	}
+	objs := k8s.RBACManifests(config.RBACName, ns, perms)
+	secret := config.Secret
+	secretEnv := []string{}
+	for k := range urls {
+		secretEnv = append(secretEnv, k)
+	}
+	if secret == "" && len(urls) > 0 {
+		secret = config.RBACName
+		objs = append(objs, k8s.RRSecretManifest(secret, ns, urls))
+	}
+	if config.Secret != "" {
+		// whatever the existing one has
+		secretEnv = []string{CMD_PREFIX + "SENTINEL_URL", CMD_PREFIX + "REDIS_URL"}
+	}
+	objs = append(objs, k8s.RRJobManifest(config.RBACName, ns, image, config.Schedule, args, env, secret, secretEnv))
+	for _, obj := range objs {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(printer.Dest, "---\n%s", b)
+	}
+	return nil
+}
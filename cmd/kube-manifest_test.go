@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommandsInArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"sentinel", "kill", "-t", "5m"}, []string{"sentinel kill"}},
+		{[]string{"sentinel", "kill", "--with-pvc"}, []string{"sentinel kill", "sentinel kill --with-pvc"}},
+		{[]string{"sentinel", "kill", "--collect", "/tmp/x"}, []string{"--collect", "sentinel kill"}},
+		{[]string{"sentinel", "kill", "--collect=/tmp/x"}, []string{"--collect", "sentinel kill"}},
+		{[]string{"sentinel", "status"}, []string{}},
+	}
+	for _, tt := range tests {
+		got := commandsInArgs(tt.args)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("commandsInArgs(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
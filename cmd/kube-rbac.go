@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// what each of the commands needs to be allowed to do in the namespace
+// populated by the commands themselves
+var requiredPermissions = map[string][]k8s.Permission{}
+
+var kubeRBACCmd = &cobra.Command{
+	Use:   "rbac",
+	Short: "Print the ServiceAccount, Role and RoleBinding needed to run rr in the cluster",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteKubeRBAC(&cfg, prtr)
+	},
+}
+
+func init() {
+	kubeCmd.AddCommand(kubeRBACCmd)
+	kubeRBACCmd.Flags().StringVar(&cfg.RBACName, "name", "rr", "Name of the ServiceAccount, Role and RoleBinding")
+	kubeRBACCmd.Flags().StringSliceVar(&cfg.RBACFor, "for", []string{}, "Commands to grant the permissions for, like \"sentinel kill\". Defaults to all")
+}
+
+func ExecuteKubeRBAC(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	perms, err := permissionsFor(config.RBACFor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	ns, err := k8s.DeriveNamespace(config.Namespace, config.Kubeconfig, config.Context)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	for _, obj := range k8s.RBACManifests(config.RBACName, ns, perms) {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(printer.Dest, "---\n%s", b)
+	}
+	return nil
+}
+
+func permissionsFor(commands []string) ([]k8s.Permission, error) {
+	known := []string{}
+	for c := range requiredPermissions {
+		known = append(known, c)
+	}
+	sort.Strings(known)
+	if len(commands) == 0 {
+		commands = known
+	}
+	perms := []k8s.Permission{}
+	for _, c := range commands {
+		if !slices.Contains(known, c) {
+			return nil, fmt.Errorf("unknown command %q; expected one of %q", c, known)
+		}
+		perms = append(perms, requiredPermissions[c]...)
+	}
+	return perms, nil
+}
+
+// fails fast when the current user isn't allowed to do everything the command needs
+func checkPermissions(k8sc kubernetes.Interface, namespace string, commands ...string) error {
+	perms, err := permissionsFor(commands)
+	if err != nil {
+		return err
+	}
+	missing, err := k8s.MissingPermissions(ctx, k8sc, namespace, perms)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	list := []string{}
+	for _, p := range missing {
+		list = append(list, p.String())
+	}
+	return fmt.Errorf(
+		"missing permissions in namespace %s: %s; use `rr kube rbac --for %q` to see what's needed",
+		namespace,
+		strings.Join(list, ", "),
+		commands[0],
+	)
+}
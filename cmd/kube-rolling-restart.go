@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+var kubeRollingRestartCmd = &cobra.Command{
+	Use:   "rolling-restart",
+	Short: "Restart all redis pods, replicas first, with a controlled failover",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteKubeRollingRestart(&cfg, prtr)
+	},
+}
+
+func init() {
+	kubeCmd.AddCommand(kubeRollingRestartCmd)
+	requiredPermissions["kube rolling-restart"] = append(
+		k8s.Permissions("", "pods", "get", "list", "watch", "delete"),
+		lockPermissions...,
+	)
+	kubeRollingRestartCmd.Flags().DurationVar(&cfg.StepTimeout, "step-timeout", 10*time.Minute, "Timeout for each of the pods to come back in sync")
+	kubeRollingRestartCmd.Flags().Int64Var(&cfg.MaxLag, "max-lag", 1024, "Max replication lag (bytes) for a restarted node to be considered in sync. Negative to only check with the sentinel")
+}
+
+func ExecuteKubeRollingRestart(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	pq, pqdone := printEvents(config, printer, time.Now())
+
+	// The plan here is:
+	// 1. read the master and the replicas from sentinel, and make sure they're all healthy
+	// 2. restart the replicas one by one, waiting for each to resync
+	// 3. failover away from the master, and wait for the new master
+	// 4. restart the old master, and wait for it to resync as a replica
+	err := rollingRestart(config, pq)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		pq <- map[string]string{
+			"done":  "true",
+			"event": "failed",
+			"msg":   err.Error(),
+		}
+	} else {
+		pq <- map[string]string{
+			"done":  "true",
+			"event": "restarted",
+		}
+	}
+	<-pqdone
+	return err
+}
+
+func rollingRestart(config *config.RRConfig, pq chan map[string]string) error {
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		return err
+	}
+	clusters, err := getClusters(config, "kube rolling-restart")
+	if err != nil {
+		return err
+	}
+	primary := clusters.Primary()
+	lock, err := lockTarget(config, primary.Client, primary.Namespace, "kube rolling-restart")
+	if err != nil {
+		return err
+	}
+	defer releaseLock(lock)
+
+	// 1. Don't make things worse, if they're already bad
+	oldMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		return err
+	}
+	pq <- map[string]string{
+		"event": "initial master",
+		"msg":   fmt.Sprintf("%s:%s", oldMaster.Host, oldMaster.Port),
+	}
+	replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		return err
+	}
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i]["ip"] < replicas[j]["ip"]
+	})
+	for _, r := range replicas {
+		if strings.Contains(r["flags"], "down") || strings.Contains(r["flags"], "disconnected") || r["master-link-status"] != "ok" {
+			return fmt.Errorf("replica %s:%s isn't healthy (flags %s, link %s); refusing to restart", r["ip"], r["port"], r["flags"], r["master-link-status"])
+		}
+	}
+
+	// 2. Replicas first
+	for _, r := range replicas {
+		node := &redisClient.RedisInstance{
+			Host:   r["ip"],
+			Port:   r["port"],
+			Master: config.SentinelMaster,
+		}
+		if err := restartReplica(config, lock, rdbs, clusters, node, pq); err != nil {
+			return err
+		}
+	}
+
+	// 3. Move the master somewhere else
+	if err := lock.Err(); err != nil {
+		return err
+	}
+	err = waitFor(lock, config.StepTimeout, func(sctx context.Context, done chan error) {
+		// subscribed before the failover, not to miss its +switch-master
+		spubsub, err := redisClient.SubscribeSentinelEvents(sctx, rdbs)
+		if err != nil {
+			done <- err
+			return
+		}
+		go redisClient.WatchNewMaster(sctx, rdbs, spubsub, done, pq, oldMaster)
+		res, err := redisClient.Failover(sctx, rdbs, config.SentinelMaster)
+		if err != nil {
+			done <- err
+			return
+		}
+		pq <- map[string]string{
+			"event": "failover",
+			"msg":   res,
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// 4. And restart the old master, which is now a replica
+	return restartReplica(config, lock, rdbs, clusters, oldMaster, pq)
+}
+
+func restartReplica(
+	config *config.RRConfig,
+	lock *k8s.Lock,
+	rdbs *redis.Client,
+	clusters *k8s.Clusters,
+	node *redisClient.RedisInstance,
+	pq chan map[string]string,
+) error {
+	// someone else might be restarting it by now
+	if err := lock.Err(); err != nil {
+		return err
+	}
+	cluster, name, err := clusters.ForHost(ctx, node.Host)
+	if err != nil {
+		return err
+	}
+	if err := k8s.RestartPod(ctx, cluster.Client, name, cluster.Namespace, pq); err != nil {
+		return err
+	}
+	err = waitFor(lock, config.StepTimeout, func(sctx context.Context, done chan error) {
+		k8s.WaitForPodReady(sctx, cluster.Client, name, cluster.Namespace, done, pq)
+	})
+	if err != nil {
+		return err
+	}
+	return waitFor(lock, config.StepTimeout, func(sctx context.Context, done chan error) {
+		redisClient.WaitForReplicaSync(sctx, rdbs, config.RedisURL, config.MaxLag, time.Second, done, pq, node)
+	})
+}
+
+// runs f in the background, and waits for it to report back, for the timeout, or for the lock to be lost
+func waitFor(lock *k8s.Lock, timeout time.Duration, f func(ctx context.Context, done chan error)) error {
+	sctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 2)
+	go f(sctx, done)
+	go abortOnLostLock(sctx, lock, done)
+	select {
+	case err := <-done:
+		return err
+	case <-sctx.Done():
+		return fmt.Errorf("timeout after %s", timeout)
+	}
+}
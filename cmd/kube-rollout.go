@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+var kubeRolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Roll out the redis StatefulSet and measure the impact on clients",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteKubeRollout(&cfg, prtr)
+	},
+}
+
+func init() {
+	kubeCmd.AddCommand(kubeRolloutCmd)
+	requiredPermissions["kube rollout"] = slices.Concat(
+		k8s.Permissions("", "pods", "get", "list", "watch"),
+		k8s.Permissions("apps", "statefulsets", "get", "patch"),
+		lockPermissions,
+	)
+	kubeRolloutCmd.Flags().StringVar(&cfg.StatefulSet, "statefulset", "", "Name of the StatefulSet to roll out. Defaults to the owner of the master pod")
+	kubeRolloutCmd.Flags().DurationVar(&cfg.RolloutTimeout, "rollout-timeout", 30*time.Minute, "Timeout for the whole rollout")
+	addProbeFlags(kubeRolloutCmd)
+}
+
+// flags for the client probe running alongside experiments
+func addProbeFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.ProbeKey, "probe-key", "rr:probe", "Key the probe writes to and reads from")
+	cmd.Flags().DurationVar(&cfg.ProbeInterval, "probe-interval", 100*time.Millisecond, "How often the probe issues a write and a read")
+	cmd.Flags().DurationVar(&cfg.ProbeSlow, "probe-slow", 500*time.Millisecond, "Latency above which the probe considers a response slow")
+	cmd.Flags().DurationVar(&cfg.ProbeTimeout, "probe-timeout", 2*time.Second, "Read and write timeout of the probe's client; longer than --probe-slow, for the slow responses to be seen as such")
+	cmd.Flags().StringVar(&cfg.HistoryFile, "history", "", "Record every operation of the probes to this NDJSON file, for rr analyze")
+}
+
+func checkProbeFlags(config *config.RRConfig) error {
+	if config.ProbeInterval <= 0 || config.ProbeSlow <= 0 || config.ProbeTimeout <= config.ProbeSlow {
+		return fmt.Errorf("--probe-interval and --probe-slow need to be positive, and --probe-timeout longer than --probe-slow")
+	}
+	return nil
+}
+
+func ExecuteKubeRollout(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	pq, pqdone := printEvents(config, printer, time.Now())
+
+	// The plan here is:
+	// 1. find the StatefulSet running the master
+	// 2. start a sentinel-aware client probe, and count the failovers
+	// 3. bump the pod template annotation to trigger a rollout
+	// 4. follow the pods restarting, until the StatefulSet reports it's done
+	// 5. summarise what the clients saw
+	if err := checkProbeFlags(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		return err
+	}
+	clusters, err := getClusters(config, "kube rollout")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	primary := clusters.Primary()
+	lock, err := lockTarget(config, primary.Client, primary.Namespace, "kube rollout")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer releaseLock(lock)
+
+	// 1. Find the StatefulSet, in the cluster of the master when not told which
+	name := config.StatefulSet
+	k8sc, ns := primary.Client, primary.Namespace
+	if name == "" {
+		master, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		cluster, pod, err := clusters.ForHost(ctx, master.Host)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		k8sc, ns = cluster.Client, cluster.Namespace
+		sts, err := k8s.GetStatefulSetForPod(ctx, k8sc, pod, ns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		name = sts.Name
+	}
+
+	// 2. Start observing
+	rctx, cancel := context.WithTimeout(ctx, config.RolloutTimeout)
+	defer cancel()
+	opts, err := redisClient.MakeFailoverOptions(config.SentinelURL, config.RedisURL, config.SentinelMaster)
+	if err != nil {
+		return err
+	}
+	opts.ReadTimeout = config.ProbeTimeout
+	opts.WriteTimeout = config.ProbeTimeout
+	p := probe.NewProbe("failover", redis.NewFailoverClient(opts), config.ProbeKey, config.ProbeInterval, config.ProbeSlow)
+	if p.History, err = openHistory(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer closeHistory(p.History)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.Run(rctx, pq)
+	}()
+	failovers := make(chan *redisClient.RedisSwitchMasterEvent)
+	go redisClient.WatchSwitchMaster(rctx, rdbs, config.SentinelMaster, failovers, pq)
+
+	// 3. Trigger the rollout
+	sts, err := k8s.RestartStatefulSet(rctx, k8sc, name, ns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	pq <- map[string]string{
+		"event":     "rollout started",
+		"msg":       sts.Name,
+		"name":      sts.Name,
+		"namespace": sts.Namespace,
+	}
+
+	// 4. Follow it until it's done
+	done := make(chan error, 2)
+	go k8s.WatchRollout(rctx, k8sc, sts, done, pq)
+	go k8s.WaitForRollout(rctx, k8sc, sts, time.Second, done, pq)
+	count := 0
+	var result error
+	for running := true; running; {
+		select {
+		case evt := <-failovers:
+			count++
+			pq <- map[string]string{
+				"event": "failover",
+				"msg":   fmt.Sprintf("%s:%s -> %s:%s", evt.OldMasterHost, evt.OldMasterPort, evt.NewMasterHost, evt.NewMasterPort),
+			}
+		case result = <-done:
+			running = false
+		case <-lock.Lost():
+			// the rollout goes on, but someone else is in charge now
+			result = lock.Err()
+			running = false
+		case <-rctx.Done():
+			result = fmt.Errorf("timeout after %s", config.RolloutTimeout)
+			running = false
+		}
+	}
+	cancel()
+	wg.Wait()
+
+	// 5. Summarise
+	summary := p.Summary()
+	summary["event"] = "summary"
+	summary["failovers"] = fmt.Sprint(count)
+	summary["done"] = "true"
+	if result != nil {
+		summary["msg"] = result.Error()
+	}
+	pq <- summary
+	<-pqdone
+	return result
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var kubeCmd = &cobra.Command{
+	Use:   "kube",
+	Short: "Operate sentinel-managed redis on Kubernetes",
+}
+
+func init() {
+	rootCmd.AddCommand(kubeCmd)
+	addSentinelFlags(kubeCmd)
+}
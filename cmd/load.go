@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/load"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+var loadCmd = &cobra.Command{
+	Use:   "load",
+	Short: "Generate load through a sentinel-aware client, reporting the throughput every second",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteLoad(&cfg, prtr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loadCmd)
+	addSentinelFlags(loadCmd)
+	loadCmd.Flags().StringSliceVar(&cfg.LoadMix, "mix", []string{"get=80", "set=20"}, fmt.Sprintf("Operations to mix, with their relative weights. Any of %s", strings.Join(load.Ops, ", ")))
+	loadCmd.Flags().IntVar(&cfg.LoadClients, "clients", 50, "Number of concurrent clients")
+	loadCmd.Flags().IntVar(&cfg.LoadRate, "rate", 0, "Target operations per second, over all the clients. 0 for as many as possible")
+	loadCmd.Flags().IntVar(&cfg.LoadKeys, "keys", 10000, "Number of keys of each type to spread the operations over")
+	loadCmd.Flags().StringVar(&cfg.LoadKeyPrefix, "key-prefix", "rr:load:", "Prefix of the keys")
+	loadCmd.Flags().IntVar(&cfg.ValueSize, "value-size", 100, "Size of the values written, in bytes")
+	loadCmd.Flags().IntVar(&cfg.PipelineSize, "pipeline-size", 10, "Number of commands in each pipeline")
+	loadCmd.Flags().DurationVar(&cfg.CheckDuration, "duration", 0, "Stop after this long. 0 to keep going until interrupted")
+	loadCmd.Flags().StringVar(&cfg.HistoryFile, "history", "", "Record every operation to this NDJSON file, for rr analyze")
+}
+
+func ExecuteLoad(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+
+	// The plan here is:
+	// 1. run the clients through a sentinel-aware client, so that the load follows the master
+	// 2. every second, report what they did in that second, alongside the failovers
+	// 3. when done, report the latencies of each operation over the whole run
+	mix, err := load.ParseMix(config.LoadMix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.LoadClients <= 0 || config.LoadKeys <= 0 || config.PipelineSize <= 0 {
+		err := fmt.Errorf("--clients, --keys and --pipeline-size need to be positive")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.ValueSize < 0 || config.LoadRate < 0 {
+		err := fmt.Errorf("--value-size and --rate can't be negative")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	master, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	opts, err := redisClient.MakeFailoverOptions(config.SentinelURL, config.RedisURL, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	opts.PoolSize = config.LoadClients
+	client := redis.NewFailoverClient(opts)
+	defer client.Close()
+	w := &load.Workload{
+		Client:       client,
+		Mix:          mix,
+		Clients:      config.LoadClients,
+		Rate:         config.LoadRate,
+		Keys:         config.LoadKeys,
+		KeyPrefix:    config.LoadKeyPrefix,
+		ValueSize:    config.ValueSize,
+		PipelineSize: config.PipelineSize,
+	}
+	if w.History, err = openHistory(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer closeHistory(w.History)
+
+	// 1. Load
+	pq, pqdone := printEvents(config, printer, start)
+	rctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if config.CheckDuration > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(rctx, config.CheckDuration)
+		defer cancel()
+	}
+	pq <- map[string]string{
+		"event":   "loading",
+		"msg":     fmt.Sprintf("%s:%s", master.Host, master.Port),
+		"mix":     strings.Join(config.LoadMix, ","),
+		"clients": fmt.Sprint(config.LoadClients),
+		"rate":    fmt.Sprint(config.LoadRate),
+	}
+	loaded := make(chan bool)
+	go func() {
+		w.Run(rctx)
+		close(loaded)
+	}()
+
+	// 2. Report every second
+	failovers := make(chan *redisClient.RedisSwitchMasterEvent)
+	go redisClient.WatchSwitchMaster(rctx, rdbs, config.SentinelMaster, failovers, pq)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := time.Now()
+	for running := true; running; {
+		select {
+		case evt := <-failovers:
+			pq <- map[string]string{
+				"event": "failover",
+				"msg":   fmt.Sprintf("%s:%s -> %s:%s", evt.OldMasterHost, evt.OldMasterPort, evt.NewMasterHost, evt.NewMasterPort),
+			}
+		case now := <-ticker.C:
+			pq <- loadTick(w.Tick(), now.Sub(last))
+			last = now
+		case <-loaded:
+			running = false
+		}
+	}
+	elapsed := time.Since(start)
+	pq <- loadTick(w.Tick(), time.Since(last))
+
+	// 3. Summarise
+	totals := w.Totals()
+	all := load.Overall(totals)
+	summary := map[string]string{
+		"done":           "true",
+		"event":          "summary",
+		"msg":            fmt.Sprintf("%d ops, %d errors", all.Ops, all.Errors),
+		"ops":            fmt.Sprint(all.Ops),
+		"errors":         fmt.Sprint(all.Errors),
+		"ops_per_second": fmt.Sprintf("%.1f", float64(all.Ops)/elapsed.Seconds()),
+		"duration":       elapsed.String(),
+	}
+	for _, t := range probe.ErrorTypes {
+		summary["errors_"+t] = fmt.Sprint(all.ErrorTypes[t])
+	}
+	pq <- summary
+	<-pqdone
+	rows := []map[string]string{}
+	for _, op := range mix.Ops() {
+		if s, ok := totals[op]; ok {
+			rows = append(rows, loadLatencies(s))
+		}
+	}
+	rows = append(rows, loadLatencies(all))
+	printer.SkipHeaders = false
+	printer.Itemise = false
+	printer.Print(rows, []string{"op", "ops", "errors", "mean", "p50", "p90", "p99", "p99.9", "p99.99", "max"})
+	return nil
+}
+
+// what the clients did since the previous tick
+func loadTick(stats map[string]*load.Stats, elapsed time.Duration) map[string]string {
+	all := load.Overall(stats)
+	return map[string]string{
+		"event":          "tick",
+		"msg":            fmt.Sprintf("%.0f ops/s", float64(all.Ops)/elapsed.Seconds()),
+		"ops":            fmt.Sprint(all.Ops),
+		"ops_per_second": fmt.Sprintf("%.1f", float64(all.Ops)/elapsed.Seconds()),
+		"errors":         fmt.Sprint(all.Errors),
+		"p50":            all.Latency.Percentile(50).String(),
+		"p99":            all.Latency.Percentile(99).String(),
+		"max":            all.Latency.Max().String(),
+	}
+}
+
+func loadLatencies(s *load.Stats) map[string]string {
+	row := map[string]string{
+		"op":     s.Op,
+		"ops":    fmt.Sprint(s.Ops),
+		"errors": fmt.Sprint(s.Errors),
+		"mean":   s.Latency.Mean().String(),
+		"max":    s.Latency.Max().String(),
+	}
+	for _, pct := range []float64{50, 90, 99, 99.9, 99.99} {
+		row[fmt.Sprintf("p%g", pct)] = s.Latency.Percentile(pct).String()
+	}
+	return row
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/operator"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var operatorCRDCmd = &cobra.Command{
+	Use:   "crd",
+	Short: "Print the RedisChaosExperiment CustomResourceDefinition",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteOperatorCRD(&cfg, prtr)
+	},
+}
+
+func init() {
+	operatorCmd.AddCommand(operatorCRDCmd)
+}
+
+func ExecuteOperatorCRD(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	b, err := yaml.Marshal(operator.CRD())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(printer.Dest, "---\n%s", b)
+	return nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/operator"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/spf13/cobra"
+)
+
+var operatorRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Reconcile the RedisChaosExperiments in the namespace until stopped",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteOperatorRun(&cfg, prtr)
+	},
+}
+
+func init() {
+	operatorCmd.AddCommand(operatorRunCmd)
+	requiredPermissions["operator run"] = slices.Concat(
+		k8s.Permissions(operator.Group, operator.Resource, "get", "list"),
+		k8s.Permissions(operator.Group, operator.Resource+"/status", "get", "update"),
+		k8s.Permissions("", "pods", "get", "list", "watch", "delete", "patch"),
+		k8s.Permissions("", "events", "create"),
+		k8s.Permissions("", "secrets", "get"),
+		lockPermissions,
+	)
+	operatorRunCmd.Flags().DurationVar(&cfg.Resync, "resync", 10*time.Second, "How often to check the experiments")
+}
+
+func ExecuteOperatorRun(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	if config.Resync <= 0 {
+		err := fmt.Errorf("--resync needs to be positive")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	k8sc, err := k8s.GetClient(config.Kubeconfig, config.Context)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	dyn, err := k8s.GetDynamicClient(config.Kubeconfig, config.Context)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	ns, err := k8s.DeriveNamespace(config.Namespace, config.Kubeconfig, config.Context)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if err := checkPermissions(k8sc, ns, "operator run"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	pq, pqdone := printEvents(config, printer, time.Now())
+	pq <- map[string]string{
+		"event": "operator started",
+		"msg":   ns,
+	}
+	sigctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	controller := operator.NewController(k8sc, dyn, ns, config.Resync, config.LockDuration)
+	err = controller.Run(sigctx, pq)
+	stopped := map[string]string{
+		"done":  "true",
+		"event": "operator stopped",
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		stopped["msg"] = err.Error()
+	}
+	pq <- stopped
+	<-pqdone
+	return err
+}
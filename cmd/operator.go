@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Run experiments declared as RedisChaosExperiment resources",
+}
+
+func init() {
+	rootCmd.AddCommand(operatorCmd)
+}
@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/bundle"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
 )
 
 var Version, Build string
@@ -13,6 +22,9 @@ var cfg config.RRConfig
 var prtr *printer.Printer
 var CMD_PREFIX = "RR_"
 
+// needed by all the commands locking the target
+var lockPermissions = k8s.Permissions("coordination.k8s.io", "leases", "get", "create", "update", "delete")
+
 var rootCmd = &cobra.Command{
 	Use:   "rr",
 	Short: "Verify resiliency of your redis setup",
@@ -43,7 +55,182 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Make the output verbose")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Pretty, "pretty", "p", false, "Make the output pretty")
 	rootCmd.PersistentFlags().StringVarP(&cfg.Format, "output", "o", "json", "Output format (json, text, wide)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Experiment, "experiment", "", "ID of the experiment, added to all the events. Generated when recording events in Kubernetes")
 	// kubernetes options
-	rootCmd.PersistentFlags().StringVar(&cfg.Kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to a kubeconfig file. Leave empty for in-cluster. (KUBECONFIG)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to a kubeconfig file. Leave empty for ~/.kube/config, or in-cluster. (KUBECONFIG)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Context, "context", "", "Name of the kubeconfig context to use. Leave empty for the current context")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Contexts, "contexts", []string{}, "Other kubeconfig contexts the redis deployment spans. The pods are looked for in all of them")
 	rootCmd.PersistentFlags().StringVar(&cfg.Namespace, "namespace", os.Getenv("NAMESPACE"), "Limit Kubernetes actions to only this namespace (NAMESPACE)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.LockDuration, "lock-duration", 30*time.Second, "How long the lock on the target outlives rr, if it dies without releasing it")
+	requiredPermissions["--collect"] = slices.Concat(
+		k8s.Permissions("", "pods", "get", "list"),
+		k8s.Permissions("", "pods/log", "get"),
+		k8s.Permissions("", "events", "list"),
+		k8s.Permissions("apps", "statefulsets", "get"),
+	)
+}
+
+// prints the events sent to the returned channel one by one, as they come
+// debug events are only printed when verbose
+// the second channel is notified after printing an event with "done" set
+// the sinks see the same events that get printed
+func printEvents(config *config.RRConfig, printer *printer.Printer, start time.Time, sinks ...func(map[string]string)) (chan map[string]string, chan bool) {
+	printer.SkipHeaders = true
+	printer.Itemise = true
+	pq := make(chan map[string]string, 10)
+	pqdone := make(chan bool)
+	go func() {
+		for {
+			data := <-pq
+			if data["debug"] != "" && !config.Verbose {
+				continue
+			}
+			delete(data, "debug")
+			data["time"] = time.Now().String()
+			data["elapsed"] = time.Since(start).String()
+			if config.Experiment != "" {
+				data["experiment"] = config.Experiment
+			}
+			for _, sink := range sinks {
+				sink(data)
+			}
+			printer.Print([]map[string]string{data}, []string{"time", "event", "msg"})
+			if data["done"] == "true" {
+				pqdone <- true
+			}
+		}
+	}()
+	return pq, pqdone
+}
+
+// the clusters the deployment spans: the one of --context first, and then the --contexts
+// fails fast when the permissions for the commands, if any, are missing in any of them
+func getClusters(config *config.RRConfig, commands ...string) (*k8s.Clusters, error) {
+	contexts := []string{config.Context}
+	for _, c := range config.Contexts {
+		if !slices.Contains(contexts, c) {
+			contexts = append(contexts, c)
+		}
+	}
+	clusters, err := k8s.NewClusters(config.Kubeconfig, config.Namespace, contexts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(commands) == 0 {
+		return clusters, nil
+	}
+	for _, cluster := range clusters.List {
+		if err := checkPermissions(cluster.Client, cluster.Namespace, commands...); err != nil {
+			if len(clusters.List) > 1 {
+				err = fmt.Errorf("%s: %s", cluster, err)
+			}
+			return nil, err
+		}
+	}
+	return clusters, nil
+}
+
+// makes sure nobody else runs a destructive experiment against the same master at the same time
+func lockTarget(config *config.RRConfig, k8sc kubernetes.Interface, namespace, command string) (*k8s.Lock, error) {
+	holder := k8s.LockHolder(config.Experiment)
+	return k8s.AcquireLock(ctx, k8sc, config.SentinelMaster, namespace, holder, command, config.LockDuration)
+}
+
+// reports the loss of the lock to done, for the experiment to stop, unless the context is done first
+func abortOnLostLock(ctx context.Context, lock *k8s.Lock, done chan error) {
+	select {
+	case <-lock.Lost():
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case done <- lock.Err():
+	case <-ctx.Done():
+	}
+}
+
+func releaseLock(lock *k8s.Lock) {
+	if err := lock.Release(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// collecting the logs and Kubernetes Events of the run, for the commands that support it
+func addCollectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.Collect, "collect", "", "After the run, save rr's events, the logs of the redis & sentinel pods and the Kubernetes Events into this directory, or .tar.gz")
+	cmd.Flags().StringVar(&cfg.CollectSelector, "collect-selector", "", "Labels of extra pods to collect the logs of, like a=b,c=d. The pods of the master's StatefulSet are always collected")
+}
+
+// keeps a copy of everything rr printed, to save along the logs
+type eventLog struct {
+	sync.Mutex
+	events []map[string]string
+}
+
+func (l *eventLog) sink(data map[string]string) {
+	evt := map[string]string{}
+	for k, v := range data {
+		evt[k] = v
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.events = append(l.events, evt)
+}
+
+// nil, unless asked to collect
+// collects from the cluster of the target pod, and the other clusters, if any
+func startCollecting(config *config.RRConfig, cluster *k8s.Cluster, start time.Time) (*k8s.Collector, error) {
+	if config.Collect == "" {
+		return nil, nil
+	}
+	w, err := bundle.NewWriter(config.Collect)
+	if err != nil {
+		return nil, err
+	}
+	return k8s.NewCollector(cluster.Client, cluster.Namespace, start, w), nil
+}
+
+// saves everything that happened to the pods around the target pod since the start
+// the other clusters only have the pods matching the --collect-selector collected, under clusters/<context>/
+// best called after the printer is done, so that the events are complete
+func finishCollecting(config *config.RRConfig, clusters *k8s.Clusters, cluster *k8s.Cluster, collector *k8s.Collector, log *eventLog, pod string) {
+	if collector == nil {
+		return
+	}
+	w := collector.Bundle()
+	report := func(err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	log.Lock()
+	report(w.AddJSON("rr-events.json", log.events, "the events printed by rr"))
+	log.Unlock()
+	for _, c := range clusters.List {
+		col, name := collector, pod
+		if c != cluster {
+			col, name = collector.In(c), ""
+		}
+		pods, err := k8s.PodsToCollect(ctx, c.Client, name, c.Namespace, config.CollectSelector)
+		report(err)
+		for _, p := range pods {
+			report(col.PodLogs(ctx, p, ""))
+		}
+		report(col.Events(ctx, time.Now()))
+	}
+	report(w.Close())
+}
+
+// the recorder for --history, nil when not asked for
+func openHistory(config *config.RRConfig) (*history.Recorder, error) {
+	if config.HistoryFile == "" {
+		return nil, nil
+	}
+	return history.NewRecorder(config.HistoryFile)
+}
+
+func closeHistory(recorder *history.Recorder) {
+	if err := recorder.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 }
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/seed"
+	"github.com/spf13/cobra"
+)
+
+var seedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Populate the master with keys of all types, to run the experiments on a realistic dataset",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteSeed(&cfg, prtr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(seedCmd)
+	addSentinelFlags(seedCmd)
+	seedCmd.Flags().IntVar(&cfg.SeedKeys, "keys", 100000, "Number of keys to write")
+	seedCmd.Flags().StringVar(&cfg.SeedPrefix, "key-prefix", "rr:seed:", "Prefix of the keys, which --cleanup deletes by")
+	seedCmd.Flags().StringSliceVar(&cfg.SeedTypes, "types", []string{"string=50", "hash=20", "list=10", "set=10", "zset=5", "stream=5"}, fmt.Sprintf("Types of keys, with their relative weights. Any of %s", strings.Join(seed.Types, ", ")))
+	seedCmd.Flags().StringVar(&cfg.SeedValueSize, "value-size", "100", "Size of the values, in bytes: N, MIN-MAX (uniform) or exp:MEAN (exponential). Takes k and m suffixes")
+	seedCmd.Flags().StringVar(&cfg.SeedElements, "elements", "10", "Number of elements of the hashes, lists, sets, sorted sets and streams, distributed like --value-size")
+	seedCmd.Flags().Float64Var(&cfg.TTLFraction, "ttl-fraction", 0, "Fraction of the keys to expire, from 0 to 1")
+	seedCmd.Flags().DurationVar(&cfg.TTL, "ttl", time.Hour, "The keys that expire do so between half of this and this")
+	seedCmd.Flags().IntVar(&cfg.SeedBatch, "batch", 100, "Number of keys written in each pipeline, or deleted in each UNLINK")
+	seedCmd.Flags().IntVar(&cfg.SeedClients, "clients", 8, "Number of concurrent clients")
+	seedCmd.Flags().BoolVar(&cfg.Cleanup, "cleanup", false, "Delete all the keys with the prefix instead")
+}
+
+func ExecuteSeed(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+
+	// The plan here is:
+	// 1. write the keys through a sentinel-aware client, in pipelines, reporting the progress every second
+	// 2. report how many keys of each type were written, and what it did to the memory of the master
+	// or, with --cleanup, SCAN for the keys with the prefix and UNLINK them
+	types, err := seed.ParseTypes(config.SeedTypes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	valueSize, err := seed.ParseDistribution(config.SeedValueSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	elements, err := seed.ParseDistribution(config.SeedElements)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.SeedKeys <= 0 || config.SeedBatch <= 0 || config.SeedClients <= 0 {
+		err := fmt.Errorf("--keys, --batch and --clients need to be positive")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.TTLFraction < 0 || config.TTLFraction > 1 || (config.TTLFraction > 0 && config.TTL <= 0) {
+		err := fmt.Errorf("--ttl-fraction needs to be between 0 and 1, with a positive --ttl")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.SeedPrefix == "" {
+		// or the cleanup would take everything with it
+		err := fmt.Errorf("--key-prefix can't be empty")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	opts, err := redisClient.MakeFailoverOptions(config.SentinelURL, config.RedisURL, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	opts.PoolSize = config.SeedClients
+	client := redis.NewFailoverClient(opts)
+	defer client.Close()
+	rctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pq, pqdone := printEvents(config, printer, start)
+
+	if config.Cleanup {
+		pq <- map[string]string{
+			"event": "cleaning",
+			"msg":   config.SeedPrefix + "*",
+		}
+		deleted, err := seed.Cleanup(rctx, client, config.SeedPrefix, config.SeedBatch)
+		if err != nil {
+			pq <- map[string]string{
+				"event": "error",
+				"msg":   err.Error(),
+			}
+		}
+		pq <- map[string]string{
+			"done":     "true",
+			"event":    "summary",
+			"msg":      fmt.Sprintf("deleted %d keys", deleted),
+			"deleted":  fmt.Sprint(deleted),
+			"duration": time.Since(start).String(),
+		}
+		<-pqdone
+		return err
+	}
+
+	// 1. Seed
+	before := usedMemory(rctx, client)
+	s := &seed.Seeder{
+		Client:      client,
+		Keys:        config.SeedKeys,
+		Prefix:      config.SeedPrefix,
+		Types:       types,
+		ValueSize:   valueSize,
+		Elements:    elements,
+		TTLFraction: config.TTLFraction,
+		TTL:         config.TTL,
+		Batch:       config.SeedBatch,
+		Clients:     config.SeedClients,
+	}
+	pq <- map[string]string{
+		"event":      "seeding",
+		"msg":        fmt.Sprintf("%d keys", config.SeedKeys),
+		"types":      strings.Join(config.SeedTypes, ","),
+		"value_size": config.SeedValueSize,
+		"elements":   config.SeedElements,
+	}
+	seeded := make(chan error)
+	go func() {
+		seeded <- s.Run(rctx)
+	}()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			keys, bytes := s.Progress()
+			pq <- map[string]string{
+				"event":   "progress",
+				"msg":     fmt.Sprintf("%d/%d keys", keys, config.SeedKeys),
+				"keys":    fmt.Sprint(keys),
+				"bytes":   fmt.Sprint(bytes),
+				"percent": fmt.Sprintf("%.1f", 100*float64(keys)/float64(config.SeedKeys)),
+			}
+		case err = <-seeded:
+			running = false
+		}
+	}
+	if err != nil {
+		pq <- map[string]string{
+			"event": "error",
+			"msg":   err.Error(),
+		}
+	}
+
+	// 2. Summarise
+	elapsed := time.Since(start)
+	keys, bytes := s.Progress()
+	after := usedMemory(ctx, client)
+	summary := map[string]string{
+		"done":            "true",
+		"event":           "summary",
+		"msg":             fmt.Sprintf("%d keys, %d bytes of values", keys, bytes),
+		"keys":            fmt.Sprint(keys),
+		"bytes":           fmt.Sprint(bytes),
+		"keys_per_second": fmt.Sprintf("%.1f", float64(keys)/elapsed.Seconds()),
+		"duration":        elapsed.String(),
+	}
+	if before >= 0 && after >= 0 {
+		summary["used_memory_before"] = fmt.Sprint(before)
+		summary["used_memory_after"] = fmt.Sprint(after)
+	}
+	for t, n := range s.ByType() {
+		summary["keys_"+t] = fmt.Sprint(n)
+	}
+	pq <- summary
+	<-pqdone
+	return err
+}
+
+// the used_memory of the master, or -1 when it can't tell
+func usedMemory(ctx context.Context, client *redis.Client) int64 {
+	info, err := client.Info(ctx, "memory").Result()
+	if err != nil {
+		return -1
+	}
+	used, err := strconv.ParseInt(redisClient.ParseInfo(info)["used_memory"], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return used
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
@@ -14,6 +16,9 @@ var sentinelFailoverCmd = &cobra.Command{
 	Use:   "failover",
 	Short: "Trigger soft redis failover",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfg.ClientProbe || cfg.ProbePinned {
+			return ExecuteSentinelFailoverWithProbes(&cfg, prtr)
+		}
 		if err := ExecuteSentinelFailover(&cfg, prtr); err != nil {
 			return err
 		}
@@ -23,6 +28,7 @@ var sentinelFailoverCmd = &cobra.Command{
 
 func init() {
 	sentinelCmd.AddCommand(sentinelFailoverCmd)
+	addClientProbeFlags(sentinelFailoverCmd)
 }
 
 func ExecuteSentinelFailover(
@@ -33,23 +39,91 @@ func ExecuteSentinelFailover(
 	if err != nil {
 		return err
 	}
-	{
-		cmd := rdb.Do(ctx, "SENTINEL", "failover", config.SentinelMaster)
-		if err := rdb.Process(ctx, cmd); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return err
-		}
-		res, err := cmd.Text()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return err
-		}
-		printer.Itemise = true
-		printer.Print([]map[string]string{
-			{
-				"result": res,
-			},
-		}, []string{})
+	res, err := redisClient.Failover(ctx, rdb, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
 	}
+	printer.Itemise = true
+	printer.Print([]map[string]string{
+		{
+			"result": res,
+		},
+	}, []string{})
 	return nil
 }
+
+// triggers the failover with the client probes running, and waits for the new master
+func ExecuteSentinelFailoverWithProbes(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		return err
+	}
+	oldMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	pq, pqdone := printEvents(config, printer, start)
+	pq <- map[string]string{
+		"event": "initial master",
+		"msg":   fmt.Sprintf("%s:%s", oldMaster.Host, oldMaster.Port),
+	}
+	probes, err := startClientProbes(config, oldMaster, pq)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	// the sentinel may report bad messages more than once
+	done := make(chan error, 1)
+	wctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	// subscribed before the failover, not to miss its +switch-master
+	spubsub, err := redisClient.SubscribeSentinelEvents(wctx, rdbs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	go redisClient.WatchNewMaster(wctx, rdbs, spubsub, done, pq, oldMaster)
+	fault := time.Now()
+	res, err := redisClient.Failover(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	pq <- map[string]string{
+		"event": "failover requested",
+		"msg":   res,
+	}
+	var result error
+	select {
+	case result = <-done:
+	case <-wctx.Done():
+		result = fmt.Errorf("timeout after %s", config.Timeout)
+	}
+	elected := time.Now()
+	cancel()
+	probes.Finish(config, fault, elected, pq)
+
+	newMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	final := map[string]string{
+		"done":  "true",
+		"event": "final master",
+		"msg":   fmt.Sprintf("%s:%s", newMaster.Host, newMaster.Port),
+	}
+	if result != nil {
+		final["error"] = result.Error()
+	}
+	pq <- final
+	<-pqdone
+	return result
+}
@@ -1,15 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
 	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 )
 
 var sentinelKillCmd = &cobra.Command{
@@ -22,50 +26,82 @@ var sentinelKillCmd = &cobra.Command{
 
 func init() {
 	sentinelCmd.AddCommand(sentinelKillCmd)
+	requiredPermissions["sentinel kill"] = append(
+		k8s.Permissions("", "pods", "get", "list", "watch", "delete"),
+		lockPermissions...,
+	)
+	requiredPermissions["sentinel kill --with-pvc"] = k8s.Permissions("", "persistentvolumeclaims", "get", "delete")
+	requiredPermissions["sentinel kill --record-events"] = append(
+		k8s.Permissions("", "pods", "patch"),
+		k8s.Permissions("", "events", "create")...,
+	)
+	sentinelKillCmd.Flags().BoolVar(&cfg.WaitRecovery, "wait-recovery", false, "Keep watching until the killed node is back as a healthy replica")
+	sentinelKillCmd.Flags().DurationVar(&cfg.RecoveryTimeout, "recovery-timeout", 10*time.Minute, "Timeout for the recovery of the killed node")
+	sentinelKillCmd.Flags().BoolVar(&cfg.WithPVC, "with-pvc", false, "Also delete the pod's PVCs to simulate disk loss, and measure the full resync. Implies --wait-recovery")
+	sentinelKillCmd.Flags().BoolVar(&cfg.RecordEvents, "record-events", false, "Record the experiment as Kubernetes Events on the pod and its StatefulSet, and annotate the pod with the experiment ID")
+	sentinelKillCmd.Flags().Int64Var(&cfg.MaxLag, "max-lag", 1024, "Max replication lag (bytes) for the recovered node to be considered in sync")
+	addCollectFlags(sentinelKillCmd)
+	addClientProbeFlags(sentinelKillCmd)
 }
 
 func ExecuteSentinelKill(
 	config *config.RRConfig,
 	printer *printer.Printer,
 ) error {
-	// we'll be emitting events one by one
-	printer.SkipHeaders = true
-	printer.Itemise = true
-	// we'll write here the messages to print
-	pq := make(chan map[string]string, 10)
-	pqdone := make(chan bool)
-	go func() {
-		for {
-			data := <-pq
-			if data["debug"] != "" && !config.Verbose {
-				continue
-			}
-			delete(data, "debug")
-			data["time"] = time.Now().String()
-			printer.Print([]map[string]string{data}, []string{"time", "event", "msg"})
-			if data["done"] == "true" {
-				pqdone <- true
-			}
-		}
-	}()
+	start := time.Now()
 
 	// The plan here is:
+	// 0. make sure we're allowed to do everything we need in Kubernetes
+	//    and that nobody else is running an experiment on the same master
+	//    and optionally, record what we're doing as Kubernetes Events
 	// 1. read the master from sentinel
 	// 2. query INFO from the master to see that it matches what sentinel gave us
 	//    by default, use the host:port from the sentinel
 	//    alternatively, use specified ingress/proxy
 	// 3. set up a sentinel event watcher
+	//    and optionally, clients probing the master, to see what the applications experience
 	// 4. kill the pod containing current master
 	//    continue killing if the master switchover hasn't happened
 	// 5. setup the maximum timeout
 	// 7. read the master from sentinel again
 	// 8. query INFO from the master again
+	// 9. optionally, wait for the killed node to come back as a replica
+	//    and if its volumes were deleted too, for the full resync
+	// 10. optionally, collect the logs and Kubernetes Events of the run
+
+	// 0. Fail fast, rather than in the middle of killing
+	commands := []string{"sentinel kill"}
+	if config.WithPVC {
+		commands = append(commands, "sentinel kill --with-pvc")
+	}
+	if config.RecordEvents {
+		commands = append(commands, "sentinel kill --record-events")
+	}
+	if config.Collect != "" {
+		commands = append(commands, "--collect")
+	}
+	clusters, err := getClusters(config, commands...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	primary := clusters.Primary()
+	lock, err := lockTarget(config, primary.Client, primary.Namespace, "sentinel kill")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer releaseLock(lock)
 
 	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
 	if err != nil {
 		return err
 	}
-	done := make(chan error)
+	// buffered, so that the losers of the race (the watcher, the killer, the lock and the timeout) don't block forever
+	done := make(chan error, 8)
+	// everything racing for the new master stops once we have a result
+	killCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// 1. Read the old master from the sentinel
 	oldMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
@@ -73,14 +109,52 @@ func ExecuteSentinelKill(
 		fmt.Fprintln(os.Stderr, err)
 		return err
 	}
+	cluster, n, err := clusters.ForHost(ctx, oldMaster.Host)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	k8sc, ns := cluster.Client, cluster.Namespace
+	sinks := []func(map[string]string){}
+	collector, err := startCollecting(config, cluster, start)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if collector != nil {
+		events := &eventLog{}
+		sinks = append(sinks, events.sink)
+		defer finishCollecting(config, clusters, cluster, collector, events, n)
+	}
+	if config.RecordEvents {
+		if config.Experiment == "" {
+			config.Experiment = k8s.NewExperimentID()
+		}
+		recorder, err := k8s.NewRecorder(ctx, k8sc, config.Experiment, n, ns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		if err := recorder.Annotate(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		sinks = append(sinks, recordKillEvents(recorder))
+	}
+	pq, pqdone := printEvents(config, printer, start, sinks...)
 	pq <- map[string]string{
 		"event": "initial master",
 		"msg":   fmt.Sprintf("%s:%s", oldMaster.Host, oldMaster.Port),
 	}
+	probes, err := startClientProbes(config, oldMaster, pq)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
 
 	// 3. Listen to sentinel events, and finish early when possible
 	go redisClient.WaitForNewMaster(
-		ctx,
+		killCtx,
 		rdbs,
 		done,
 		pq,
@@ -88,19 +162,24 @@ func ExecuteSentinelKill(
 	)
 
 	// 4. Keep killing the pods without grace period
-	k8sc, err := k8s.GetClient(config.Kubeconfig)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return err
+	// the logs of the master are gone with the pod, so grab them first
+	if collector != nil {
+		if err := collector.PodLogs(ctx, n, ".before-kill"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
 	}
-	ns := k8s.DeriveNamespace(cfg.Namespace)
-	n, err := k8s.GuessPodNameFromHost(oldMaster.Host)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return err
+	// simulate disk loss: the claims go away along with the pod
+	var claims map[string]types.UID
+	if config.WithPVC {
+		claims, err = k8s.DeletePodVolumes(ctx, k8sc, n, ns, pq)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
 	}
+	fault := time.Now()
 	go k8s.KeepPodDead(
-		ctx,
+		killCtx,
 		k8sc,
 		n,
 		ns,
@@ -109,9 +188,16 @@ func ExecuteSentinelKill(
 		pq,
 	)
 
+	// stop killing, if someone else has taken over
+	go abortOnLostLock(killCtx, lock, done)
+
 	// 5. Setup the max time this all should take
 	go func(timeout time.Duration) {
-		time.Sleep(timeout)
+		select {
+		case <-killCtx.Done():
+			return
+		case <-time.After(timeout):
+		}
 		pq <- map[string]string{
 			"event":    "timeout",
 			"duration": timeout.String(),
@@ -121,6 +207,11 @@ func ExecuteSentinelKill(
 
 	// wait for the race to end
 	result := <-done
+	elected := time.Now()
+	cancel()
+	if probes != nil {
+		probes.Finish(config, fault, elected, pq)
+	}
 
 	// 7. Read the master again from the sentinel
 	newMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
@@ -128,14 +219,133 @@ func ExecuteSentinelKill(
 		fmt.Fprintln(os.Stderr, err)
 		return err
 	}
-	pq <- map[string]string{
-		"done":  "true",
+	finalMaster := map[string]string{
 		"event": "final master",
 		"msg":   fmt.Sprintf("%s:%s", newMaster.Host, newMaster.Port),
 	}
+	if !(config.WaitRecovery || config.WithPVC) || result != nil {
+		finalMaster["done"] = "true"
+		pq <- finalMaster
+		<-pqdone
+		return result
+	}
+	pq <- finalMaster
+
+	// 9. Wait for the killed pod to come back, and catch up as a replica
+	summary, err := waitForRecovery(config, rdbs, k8sc, n, ns, claims, oldMaster, start, pq)
+	summary["done"] = "true"
+	pq <- summary
 
 	// wait up for any in-transit messages
 	<-pqdone
 
-	return result
+	return err
+}
+
+type recoveryStage struct {
+	name    string
+	err     error
+	details map[string]string
+}
+
+// runs the recovery stages in parallel, and returns the summary of their timing
+func waitForRecovery(
+	config *config.RRConfig,
+	rdbs *redis.Client,
+	k8sc kubernetes.Interface,
+	name, namespace string,
+	claims map[string]types.UID,
+	node *redisClient.RedisInstance,
+	start time.Time,
+	pq chan map[string]string,
+) (map[string]string, error) {
+	rctx, cancel := context.WithTimeout(ctx, config.RecoveryTimeout)
+	defer cancel()
+	stages := make(chan recoveryStage, 5)
+	count := 0
+	wait := func(name string, f func(done chan error)) {
+		count++
+		done := make(chan error, 1)
+		go f(done)
+		go func() {
+			select {
+			case err := <-done:
+				stages <- recoveryStage{name: name, err: err}
+			case <-rctx.Done():
+			}
+		}()
+	}
+	wait("pod_ready", func(done chan error) {
+		k8s.WaitForPodReady(rctx, k8sc, name, namespace, done, pq)
+	})
+	wait("replica_reported", func(done chan error) {
+		redisClient.WaitForReplica(rctx, rdbs, done, pq, node)
+	})
+	wait("replica_in_sync", func(done chan error) {
+		redisClient.WaitForReplicaSync(rctx, rdbs, config.RedisURL, config.MaxLag, time.Second, done, pq, node)
+	})
+	if claims != nil {
+		wait("pvc_recreated", func(done chan error) {
+			k8s.WaitForFreshVolumes(rctx, k8sc, name, namespace, claims, time.Second, done, pq)
+		})
+		count++
+		go func() {
+			details, err := redisClient.WaitForFullSync(rctx, config.RedisURL, 100*time.Millisecond, pq, node)
+			stages <- recoveryStage{name: "full_sync", err: err, details: details}
+		}()
+	}
+
+	summary := map[string]string{
+		"event": "recovered",
+	}
+	var err error
+	for ; err == nil && count > 0; count-- {
+		select {
+		case <-rctx.Done():
+			err = fmt.Errorf("recovery timeout after %s", config.RecoveryTimeout)
+		case s := <-stages:
+			if s.err != nil {
+				err = s.err
+				break
+			}
+			summary[s.name] = time.Since(start).String()
+			for k, v := range s.details {
+				summary[k] = v
+			}
+		}
+	}
+	if err != nil {
+		summary["event"] = "recovery failed"
+		summary["msg"] = err.Error()
+		return summary, err
+	}
+	summary["msg"] = time.Since(start).String()
+	return summary, nil
+}
+
+// turns the milestones of the kill into Kubernetes Events
+func recordKillEvents(recorder *k8s.Recorder) func(map[string]string) {
+	reasons := map[string]string{
+		"initial master": "ExperimentStarted",
+		"deleting pod":   "PodDeleted",
+		"deleting pvc":   "PVCDeleted",
+		"final master":   "NewMasterElected",
+	}
+	return func(data map[string]string) {
+		record := func(reason, msg string) {
+			if err := recorder.Event(ctx, reason, msg); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		msg := data["msg"]
+		if msg == "" {
+			msg = data["name"]
+		}
+		if reason, ok := reasons[data["event"]]; ok {
+			record(reason, fmt.Sprintf("rr sentinel kill: %s %s", data["event"], msg))
+		}
+		if data["done"] == "true" {
+			record("ExperimentFinished", fmt.Sprintf("rr sentinel kill: %s %s", data["event"], msg))
+		}
+	}
 }
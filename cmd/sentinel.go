@@ -2,9 +2,17 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
 	"github.com/spf13/cobra"
 )
 
@@ -17,17 +25,144 @@ var sentinelCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(sentinelCmd)
+	addSentinelFlags(sentinelCmd)
+	sentinelCmd.PersistentFlags().DurationVarP(&cfg.Timeout, "timeout", "t", 60*time.Second, "Timeout for killing")
+	sentinelCmd.PersistentFlags().DurationVarP(&cfg.Grace, "grace", "g", 0*time.Second, "Grace period for killing")
+}
+
+// flags needed to find the master through the sentinel
+// shared by all the commands talking to the sentinel
+func addSentinelFlags(cmd *cobra.Command) {
 	master := os.Getenv(CMD_PREFIX + "SENTINEL_MASTER")
 	if master == "" {
 		master = "mymaster"
 	}
-	sentinelCmd.PersistentFlags().StringVar(
+	cmd.PersistentFlags().StringVar(
 		&cfg.SentinelURL,
 		"sentinel",
 		os.Getenv(CMD_PREFIX+"SENTINEL_URL"),
 		"Redis URL of the sentinel. Use "+CMD_PREFIX+"SENTINEL_URL",
 	)
-	sentinelCmd.PersistentFlags().StringVar(&cfg.SentinelMaster, "master", master, "Redis master name")
-	sentinelCmd.PersistentFlags().DurationVarP(&cfg.Timeout, "timeout", "t", 60*time.Second, "Timeout for killing")
-	sentinelCmd.PersistentFlags().DurationVarP(&cfg.Grace, "grace", "g", 0*time.Second, "Grace period for killing")
+	cmd.PersistentFlags().StringVar(&cfg.SentinelMaster, "master", master, "Redis master name")
+	cmd.PersistentFlags().StringVar(
+		&cfg.RedisURL,
+		"redis",
+		os.Getenv(CMD_PREFIX+"REDIS_URL"),
+		"Redis URL used to connect to the nodes directly; host and port come from the sentinel. Use "+CMD_PREFIX+"REDIS_URL",
+	)
+}
+
+// flags for the client probes running while the master fails over
+func addClientProbeFlags(cmd *cobra.Command) {
+	addProbeFlags(cmd)
+	cmd.Flags().BoolVar(&cfg.ClientProbe, "probe", false, "Run a sentinel-aware client throughout, and report what it experienced")
+	cmd.Flags().BoolVar(&cfg.ProbePinned, "probe-pinned", false, "Also run a plain client pinned to the address of the initial master. Implies --probe")
+	cmd.Flags().DurationVar(&cfg.ProbeSettle, "probe-settle", 5*time.Second, "How long to keep probing once the new master is elected")
+}
+
+// the probes issuing reads and writes while the master fails over
+type clientProbes struct {
+	probes  []*probe.Probe
+	history *history.Recorder
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// starts a probe with a FailoverClient, and optionally one with a client pinned to the master
+// nil when not asked for
+func startClientProbes(
+	config *config.RRConfig,
+	master *redisClient.RedisInstance,
+	pq chan map[string]string,
+) (*clientProbes, error) {
+	if !config.ClientProbe && !config.ProbePinned {
+		return nil, nil
+	}
+	if err := checkProbeFlags(config); err != nil {
+		return nil, err
+	}
+	opts, err := redisClient.MakeFailoverOptions(config.SentinelURL, config.RedisURL, config.SentinelMaster)
+	if err != nil {
+		return nil, err
+	}
+	opts.ReadTimeout = config.ProbeTimeout
+	opts.WriteTimeout = config.ProbeTimeout
+	// to tell the writes the new master served from the ones before
+	tracker := &probe.Tracker{TLSConfig: opts.TLSConfig, Ignore: opts.SentinelAddrs}
+	opts.Dialer = tracker.Dial
+	failover := probe.NewProbe("failover client", redis.NewFailoverClient(opts), config.ProbeKey, config.ProbeInterval, config.ProbeSlow)
+	failover.Tracker = tracker
+	probes := []*probe.Probe{failover}
+	if config.ProbePinned {
+		opts, err := redisClient.MakeNodeOptions(config.RedisURL, master)
+		if err != nil {
+			return nil, err
+		}
+		opts.ReadTimeout = config.ProbeTimeout
+		opts.WriteTimeout = config.ProbeTimeout
+		// a key of its own, not to mistake the writes of the other probe for stale reads
+		probes = append(probes, probe.NewProbe("pinned client", redis.NewClient(opts), config.ProbeKey+":pinned", config.ProbeInterval, config.ProbeSlow))
+	}
+	recorder, err := openHistory(config)
+	if err != nil {
+		return nil, err
+	}
+	pctx, cancel := context.WithCancel(ctx)
+	cp := &clientProbes{probes: probes, history: recorder, cancel: cancel}
+	for _, p := range probes {
+		p.History = recorder
+		cp.wg.Add(1)
+		go func() {
+			defer cp.wg.Done()
+			p.Run(pctx, pq)
+		}()
+	}
+	return cp, nil
+}
+
+// keeps probing for --probe-settle, and then reports what each of the clients experienced
+// since the fault was injected, and how long it took to write to the new master
+func (cp *clientProbes) Finish(
+	config *config.RRConfig,
+	fault, elected time.Time,
+	pq chan map[string]string,
+) {
+	time.Sleep(config.ProbeSettle)
+	cp.cancel()
+	cp.wg.Wait()
+	newMaster := ""
+	if rdbs, err := redisClient.MakeRedisClient(config.SentinelURL); err == nil {
+		if m, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster); err == nil {
+			newMaster = net.JoinHostPort(m.Host, m.Port)
+		}
+		rdbs.Close()
+	}
+	for i, p := range cp.probes {
+		summary := p.Summary()
+		summary["event"] = "client probe"
+		summary["msg"] = fmt.Sprintf("%s errors, unavailable for %s", summary["errors"], summary["unavailable"])
+		if i == 0 {
+			// served by the new master, however soon after the fault the client got there
+			if newMaster == "" {
+				summary["first_write_on_new_master"] = "unknown"
+			} else if r, ok := p.FirstSuccess("set", newMaster, fault); ok {
+				summary["first_write_on_new_master"] = r.Start.Add(r.Latency).Sub(fault).String()
+			} else {
+				summary["first_write_on_new_master"] = "none"
+			}
+			summary["new_master"] = newMaster
+		} else {
+			// the pinned client should see nothing but errors after that
+			accepted := 0
+			for _, r := range p.Results() {
+				if r.Op == "set" && r.Err == nil && r.Start.After(elected) {
+					accepted++
+				}
+			}
+			summary["writes_accepted_after_election"] = fmt.Sprint(accepted)
+		}
+		pq <- summary
+		p.Client.Close()
+	}
+	closeHistory(cp.history)
 }
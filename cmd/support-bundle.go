@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/bundle"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/spf13/cobra"
+)
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Snapshot everything useful for debugging the redis deployment into an archive",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteSupportBundle(&cfg, prtr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+	addSentinelFlags(supportBundleCmd)
+	requiredPermissions["support-bundle"] = slices.Concat(
+		k8s.Permissions("", "pods", "get", "list"),
+		k8s.Permissions("apps", "statefulsets", "get", "list"),
+		k8s.Permissions("policy", "poddisruptionbudgets", "list"),
+		k8s.Permissions("", "events", "list"),
+	)
+	supportBundleCmd.Flags().StringVarP(&cfg.BundleFile, "file", "f", "", "Where to write the bundle; a .tar.gz archive, or a directory otherwise. Defaults to rr-support-<time>.tar.gz")
+	supportBundleCmd.Flags().BoolVar(&cfg.SkipKube, "skip-kube", false, "Don't snapshot the Kubernetes objects")
+}
+
+func ExecuteSupportBundle(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	// The plan here is:
+	// 1. ask the sentinel for the master, the replicas and the other sentinels
+	// 2. from every sentinel, save its view of the master, the replicas and the sentinels
+	//    along with its INFO and config
+	// 3. from every node, save INFO all and the config
+	// 4. save the pods, the StatefulSet, the PodDisruptionBudgets and the Events
+	// none of it is fatal, the gaps are recorded in the index
+	path := config.BundleFile
+	if path == "" {
+		path = fmt.Sprintf("rr-support-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	w, err := bundle.NewWriter(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	// 1. The first sentinel tells us about everything else
+	// without the master, there's still the replicas and the sentinels to save
+	nodes := []*redisClient.RedisInstance{}
+	master, masterErr := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if masterErr != nil {
+		fmt.Fprintln(os.Stderr, masterErr)
+		w.AddError("master", masterErr)
+	} else {
+		nodes = append(nodes, master)
+	}
+	replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		w.AddError("nodes", err)
+	}
+	for _, r := range replicas {
+		nodes = append(nodes, &redisClient.RedisInstance{
+			Host:   r["ip"],
+			Port:   r["port"],
+			Master: config.SentinelMaster,
+		})
+	}
+	sentinels := []*redisClient.RedisInstance{}
+	if host, port, err := net.SplitHostPort(rdbs.Options().Addr); err == nil {
+		sentinels = append(sentinels, &redisClient.RedisInstance{Host: host, Port: port})
+	}
+	others, err := redisClient.GetSentinelsFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		w.AddError("sentinels", err)
+	}
+	for _, s := range others {
+		sentinels = append(sentinels, &redisClient.RedisInstance{Host: s["ip"], Port: s["port"]})
+	}
+
+	// 2. Every sentinel might see things differently
+	for _, s := range sentinels {
+		dir := fmt.Sprintf("sentinels/%s", bundleName(s))
+		rdb, err := redisClient.MakeNodeClient(config.SentinelURL, s)
+		if err != nil {
+			w.AddError(dir, err)
+			continue
+		}
+		saveSentinel(config, rdb, dir, w)
+		rdb.Close()
+	}
+
+	// 3. Every node, as seen by itself
+	for _, n := range nodes {
+		dir := fmt.Sprintf("nodes/%s", bundleName(n))
+		rdb, err := redisClient.MakeNodeClient(config.RedisURL, n)
+		if err != nil {
+			w.AddError(dir, err)
+			continue
+		}
+		saveNode(rdb, dir, w, false)
+		rdb.Close()
+	}
+
+	// 4. And the Kubernetes side of things
+	if !config.SkipKube {
+		err := masterErr
+		if err == nil {
+			err = saveKube(config, master, w)
+		}
+		if err != nil {
+			w.AddError("kubernetes", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	printer.Print(w.Index(), []string{"file", "size", "error"})
+	fmt.Fprintf(os.Stderr, "written to %s\n", path)
+	return nil
+}
+
+// host_port, safe to use as a file name
+func bundleName(node *redisClient.RedisInstance) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(net.JoinHostPort(node.Host, node.Port))
+}
+
+func saveSentinel(config *config.RRConfig, rdb *redis.Client, dir string, w *bundle.Writer) {
+	details, err := redisClient.GetMasterDetailsFromSentinel(ctx, rdb, config.SentinelMaster)
+	saveJSON(w, dir+"/master.json", details, err, "SENTINEL MASTER")
+	replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdb, config.SentinelMaster)
+	saveJSON(w, dir+"/replicas.json", replicas, err, "SENTINEL REPLICAS")
+	sentinels, err := redisClient.GetSentinelsFromSentinel(ctx, rdb, config.SentinelMaster)
+	saveJSON(w, dir+"/sentinels.json", sentinels, err, "SENTINEL SENTINELS")
+	saveNode(rdb, dir, w, true)
+}
+
+func saveNode(rdb *redis.Client, dir string, w *bundle.Writer, sentinel bool) {
+	info, err := rdb.Info(ctx, "all").Result()
+	if err != nil {
+		w.AddError(dir+"/info.txt", err)
+	} else if err := w.Add(dir+"/info.txt", []byte(info), "INFO all"); err != nil {
+		w.AddError(dir+"/info.txt", err)
+	}
+	config, err := redisClient.GetRedactedConfig(ctx, rdb, sentinel)
+	description := "CONFIG GET *, with the credentials redacted"
+	if sentinel {
+		description = "SENTINEL " + description
+	}
+	saveJSON(w, dir+"/config.json", config, err, description)
+}
+
+func saveJSON(w *bundle.Writer, file string, v any, err error, description string) {
+	if err == nil {
+		err = w.AddJSON(file, v, description)
+	}
+	if err != nil {
+		w.AddError(file, err)
+	}
+}
+
+// the snapshot is of the cluster running the master
+func saveKube(config *config.RRConfig, master *redisClient.RedisInstance, w *bundle.Writer) error {
+	clusters, err := getClusters(config)
+	if err != nil {
+		return err
+	}
+	cluster, name, err := clusters.ForHost(ctx, master.Host)
+	if err != nil {
+		return err
+	}
+	return k8s.SnapshotObjects(ctx, cluster.Client, name, cluster.Namespace, w)
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/config"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/printer"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/verify"
+	"github.com/spf13/cobra"
+)
+
+var verifyConsistencyCmd = &cobra.Command{
+	Use:   "consistency",
+	Short: "Compare the keys on every replica with the master, reporting the missing, extra and different ones",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ExecuteVerifyConsistency(&cfg, prtr)
+	},
+}
+
+func init() {
+	verifyCmd.AddCommand(verifyConsistencyCmd)
+	verifyConsistencyCmd.Flags().StringVar(&cfg.Match, "match", "*", "Only compare the keys matching this pattern, as in SCAN MATCH")
+	verifyConsistencyCmd.Flags().IntVar(&cfg.ScanCount, "count", 1000, "SCAN COUNT, and the number of keys digested in each pipeline")
+	verifyConsistencyCmd.Flags().StringVar(&cfg.Digest, "digest", verify.DigestContent, fmt.Sprintf("How to compare the values. Any of %s", strings.Join(verify.Digests, ", ")))
+	verifyConsistencyCmd.Flags().IntVar(&cfg.Rechecks, "rechecks", 3, "How many times to read the differing keys again, before reporting them. The writes in flight make the scans differ")
+	verifyConsistencyCmd.Flags().DurationVar(&cfg.RecheckInterval, "recheck-interval", time.Second, "Pause before each recheck, for the replicas to catch up")
+	verifyConsistencyCmd.Flags().IntVar(&cfg.Examples, "examples", 10, "How many of the differing keys of each replica to list")
+}
+
+func ExecuteVerifyConsistency(
+	config *config.RRConfig,
+	printer *printer.Printer,
+) error {
+	start := time.Now()
+
+	// The plan here is:
+	// 1. find the master and the replicas through the sentinel, and check who each replica follows
+	// 2. SCAN all of them at once, with the same pattern, getting the TYPE and a digest of every key
+	// 3. read the keys that differ again, a few times, until they converge, or the rechecks run out
+	// 4. report the missing, extra and mismatched keys of each replica
+	if !slices.Contains(verify.Digests, config.Digest) {
+		err := fmt.Errorf("unknown digest %s; expected one of %s", config.Digest, strings.Join(verify.Digests, ", "))
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if config.ScanCount <= 0 || config.Rechecks < 0 || config.Examples < 0 {
+		err := fmt.Errorf("--count needs to be positive, and --rechecks and --examples can't be negative")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	rdbs, err := redisClient.MakeRedisClient(config.SentinelURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	master, err := redisClient.GetMasterFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, config.SentinelMaster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if len(replicas) == 0 {
+		err := fmt.Errorf("no replicas to compare")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	mrdb, err := redisClient.MakeNodeClient(config.RedisURL, master)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer mrdb.Close()
+	v := &verify.Verifier{
+		Master:          &verify.Node{Name: fmt.Sprintf("%s:%s", master.Host, master.Port), Client: mrdb},
+		Match:           config.Match,
+		Count:           config.ScanCount,
+		Digest:          config.Digest,
+		Rechecks:        config.Rechecks,
+		RecheckInterval: config.RecheckInterval,
+	}
+	pq, pqdone := printEvents(config, printer, start)
+
+	// 1. Find the replicas
+	following := map[string]string{}
+	for _, r := range replicas {
+		node := &redisClient.RedisInstance{Host: r["ip"], Port: r["port"]}
+		rdb, err := redisClient.MakeNodeClient(config.RedisURL, node)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+		defer rdb.Close()
+		name := fmt.Sprintf("%s:%s", node.Host, node.Port)
+		v.Replicas = append(v.Replicas, &verify.Node{Name: name, Client: rdb})
+		evt := map[string]string{
+			"event":   "replica",
+			"msg":     name,
+			"replica": name,
+			"flags":   r["flags"],
+		}
+		if info, err := redisClient.GetReplicationInfo(ctx, rdb); err == nil {
+			following[name] = fmt.Sprintf("%s:%s", info["master_host"], info["master_port"])
+			evt["following"] = following[name]
+			evt["master_link_status"] = info["master_link_status"]
+			// with the same data, it might still not be replicating from the right master
+			if following[name] != v.Master.Name {
+				evt["event"] = "replica not following the master"
+			}
+		}
+		pq <- evt
+	}
+
+	// 2. & 3. Scan and recheck
+	v.OnScanned = func(node string, keys int) {
+		pq <- map[string]string{
+			"event": "scanned",
+			"msg":   fmt.Sprintf("%s: %d keys", node, keys),
+			"node":  node,
+			"keys":  fmt.Sprint(keys),
+		}
+	}
+	v.OnRecheck = func(replica string, pass, remaining int) {
+		pq <- map[string]string{
+			"debug":     "true",
+			"event":     "recheck",
+			"msg":       fmt.Sprintf("%s: %d keys still differ", replica, remaining),
+			"replica":   replica,
+			"pass":      fmt.Sprint(pass),
+			"remaining": fmt.Sprint(remaining),
+		}
+	}
+	rctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	res, err := v.Run(rctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		pq <- map[string]string{
+			"done":  "true",
+			"event": "failed",
+			"msg":   err.Error(),
+		}
+		<-pqdone
+		return err
+	}
+
+	// 4. Report
+	rows := []map[string]string{}
+	for _, rr := range res.Replicas {
+		row := map[string]string{
+			"replica":    rr.Name,
+			"following":  following[rr.Name],
+			"keys":       fmt.Sprint(rr.Keys),
+			"missing":    fmt.Sprint(rr.Count(verify.Missing)),
+			"extra":      fmt.Sprint(rr.Count(verify.Extra)),
+			"mismatched": fmt.Sprint(rr.Count(verify.Mismatch)),
+			"resolved":   fmt.Sprint(rr.Resolved),
+		}
+		if rr.Err != nil {
+			row["error"] = rr.Err.Error()
+		}
+		rows = append(rows, row)
+		for _, d := range rr.Discrepancies[:min(len(rr.Discrepancies), config.Examples)] {
+			pq <- map[string]string{
+				"event":          d.Kind,
+				"msg":            fmt.Sprintf("%s: %s", rr.Name, d.Key),
+				"replica":        rr.Name,
+				"key":            d.Key,
+				"master_digest":  d.Master,
+				"replica_digest": d.Replica,
+			}
+		}
+	}
+	consistent := res.Consistent()
+	for _, name := range following {
+		consistent = consistent && name == v.Master.Name
+	}
+	msg := "the replicas match the master"
+	if !consistent {
+		msg = "the replicas differ from the master"
+	}
+	pq <- map[string]string{
+		"done":        "true",
+		"event":       "summary",
+		"msg":         msg,
+		"consistent":  fmt.Sprint(consistent),
+		"master":      v.Master.Name,
+		"master_keys": fmt.Sprint(res.MasterKeys),
+		"replicas":    fmt.Sprint(len(res.Replicas)),
+		"duration":    time.Since(start).String(),
+	}
+	<-pqdone
+	printer.SkipHeaders = false
+	printer.Itemise = false
+	printer.Print(rows, []string{"replica", "following", "keys", "missing", "extra", "mismatched", "resolved", "error"})
+	if !consistent {
+		err := fmt.Errorf("%s", msg)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	return nil
+}
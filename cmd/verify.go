@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the state of the data across the nodes, after the dust settles",
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	addSentinelFlags(verifyCmd)
+}
@@ -0,0 +1,209 @@
+package analyze
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+)
+
+// a period of time when nothing succeeded
+type Window struct {
+	Start  time.Duration
+	End    time.Duration
+	Failed int
+}
+
+// a read returning something older than a write acknowledged before it started
+type StaleRead struct {
+	Read *history.Operation
+	// the latest write acknowledged before the read started
+	Latest *history.Operation
+}
+
+// a write acknowledged, and never seen again by the reads that came after
+type LostWrite struct {
+	Write *history.Operation
+	// the first of the reads after it
+	Read *history.Operation
+}
+
+// what an analysis of a history found
+type Result struct {
+	Operations []*history.Operation
+	Ok         int
+	Fail       int
+	Info       int
+	Processes  int
+	Keys       int
+	Duration   time.Duration
+	Windows    []Window
+	// of the successful operations, by function
+	Latencies  map[string][]time.Duration
+	StaleReads []StaleRead
+	LostWrites []LostWrite
+}
+
+func (r *Result) Unavailable() (total, longest time.Duration) {
+	for _, w := range r.Windows {
+		total += w.End - w.Start
+		longest = max(longest, w.End-w.Start)
+	}
+	return total, longest
+}
+
+func Analyze(ops []history.Op) *Result {
+	operations := history.Pair(ops)
+	res := &Result{
+		Operations: operations,
+		Latencies:  map[string][]time.Duration{},
+	}
+	processes := map[string]bool{}
+	keys := map[string]bool{}
+	for _, op := range ops {
+		res.Duration = max(res.Duration, op.Time)
+	}
+	for _, o := range operations {
+		processes[o.Process] = true
+		if o.Key != "" {
+			keys[o.Key] = true
+		}
+		switch o.Type {
+		case history.Ok:
+			res.Ok++
+			res.Latencies[o.F] = append(res.Latencies[o.F], o.Latency())
+		case history.Fail:
+			res.Fail++
+		default:
+			res.Info++
+		}
+	}
+	res.Processes = len(processes)
+	res.Keys = len(keys)
+	res.Windows = windows(operations)
+	for _, ops := range ByKey(operations) {
+		stale, lost := registerAnomalies(ops)
+		res.StaleReads = append(res.StaleReads, stale...)
+		res.LostWrites = append(res.LostWrites, lost...)
+	}
+	slices.SortFunc(res.StaleReads, func(a, b StaleRead) int {
+		return cmp.Compare(a.Read.Invoke, b.Read.Invoke)
+	})
+	slices.SortFunc(res.LostWrites, func(a, b LostWrite) int {
+		return cmp.Compare(a.Write.Invoke, b.Write.Invoke)
+	})
+	return res
+}
+
+// the operations on each key, in the order they were invoked
+func ByKey(operations []*history.Operation) map[string][]*history.Operation {
+	keys := map[string][]*history.Operation{}
+	for _, o := range operations {
+		if o.Key == "" {
+			continue
+		}
+		keys[o.Key] = append(keys[o.Key], o)
+	}
+	return keys
+}
+
+// a window opens with the first failure, and closes with the next success of any of the processes
+func windows(operations []*history.Operation) []Window {
+	done := slices.Clone(operations)
+	slices.SortFunc(done, func(a, b *history.Operation) int {
+		return cmp.Compare(a.Complete, b.Complete)
+	})
+	res := []Window{}
+	var open *Window
+	for _, o := range done {
+		if o.Type != history.Ok {
+			if open == nil {
+				open = &Window{Start: o.Invoke}
+			}
+			open.Failed++
+			continue
+		}
+		if open != nil {
+			open.End = max(open.Start, o.Invoke)
+			res = append(res, *open)
+			open = nil
+		}
+	}
+	if open != nil && len(done) > 0 {
+		open.End = done[len(done)-1].Complete
+		res = append(res, *open)
+	}
+	return res
+}
+
+// the stale reads and the lost writes among the operations on a key, treated as a register
+// a value written more than once can't tell which write a read saw, so it's skipped
+func registerAnomalies(ops []*history.Operation) ([]StaleRead, []LostWrite) {
+	writes := map[string][]*history.Operation{}
+	acked := []*history.Operation{}
+	reads := []*history.Operation{}
+	for _, o := range ops {
+		switch {
+		case o.F == history.Write && o.Value != nil:
+			writes[*o.Value] = append(writes[*o.Value], o)
+			if o.Type == history.Ok {
+				acked = append(acked, o)
+			}
+		case o.F == history.Read && o.Type == history.Ok:
+			reads = append(reads, o)
+		}
+	}
+	// whether the read definitely saw something written before the write started
+	// false when it can't tell
+	older := func(read, write *history.Operation) bool {
+		if read.Value == nil {
+			return true
+		}
+		seen := writes[*read.Value]
+		if len(seen) != 1 {
+			return false
+		}
+		return seen[0].Complete < write.Invoke
+	}
+	stale := []StaleRead{}
+	byCompletion := slices.Clone(acked)
+	slices.SortFunc(byCompletion, func(a, b *history.Operation) int {
+		return cmp.Compare(a.Complete, b.Complete)
+	})
+	// the reads come in the order they were invoked, so the writes acknowledged before each only add up
+	var latest *history.Operation
+	next := 0
+	for _, r := range reads {
+		// the one invoked last of the writes acknowledged before the read, which the read has to see, or something newer
+		for ; next < len(byCompletion) && byCompletion[next].Complete < r.Invoke; next++ {
+			if latest == nil || byCompletion[next].Invoke > latest.Invoke {
+				latest = byCompletion[next]
+			}
+		}
+		if latest != nil && older(r, latest) {
+			stale = append(stale, StaleRead{Read: r, Latest: latest})
+		}
+	}
+	lost := []LostWrite{}
+	for _, w := range acked {
+		var first *history.Operation
+		gone := true
+		for _, r := range reads {
+			if r.Invoke <= w.Complete {
+				continue
+			}
+			if !older(r, w) {
+				gone = false
+				break
+			}
+			if first == nil {
+				first = r
+			}
+		}
+		if gone && first != nil {
+			lost = append(lost, LostWrite{Write: w, Read: first})
+		}
+	}
+	return stale, lost
+}
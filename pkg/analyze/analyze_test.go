@@ -0,0 +1,117 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+)
+
+// an operation on the key k, between the given milliseconds
+func operation(process, f string, value *string, typ string, invoke, complete int) *history.Operation {
+	return &history.Operation{
+		Process:  process,
+		F:        f,
+		Key:      "k",
+		Value:    value,
+		Type:     typ,
+		Invoke:   time.Duration(invoke) * time.Millisecond,
+		Complete: time.Duration(complete) * time.Millisecond,
+	}
+}
+
+func TestRegisterAnomalies(t *testing.T) {
+	v := history.Value
+	tests := []struct {
+		name  string
+		ops   []*history.Operation
+		stale int
+		lost  int
+	}{
+		{
+			name: "read after write",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("b", history.Read, v(1), history.Ok, 2, 3),
+			},
+		},
+		{
+			name: "stale read, and the write never seen again",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("a", history.Write, v(2), history.Ok, 2, 3),
+				operation("b", history.Read, v(1), history.Ok, 4, 5),
+			},
+			stale: 1,
+			lost:  1,
+		},
+		{
+			name: "stale read, and the write seen later",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("a", history.Write, v(2), history.Ok, 2, 3),
+				operation("b", history.Read, v(1), history.Ok, 4, 5),
+				operation("b", history.Read, v(2), history.Ok, 6, 7),
+			},
+			stale: 1,
+		},
+		{
+			name: "the key gone",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("b", history.Read, nil, history.Ok, 2, 3),
+			},
+			stale: 1,
+			lost:  1,
+		},
+		{
+			name: "a concurrent write can go either way",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("a", history.Write, v(2), history.Ok, 2, 6),
+				operation("b", history.Read, v(1), history.Ok, 3, 4),
+				operation("b", history.Read, v(2), history.Ok, 5, 7),
+			},
+		},
+		{
+			name: "a pending write can be seen any time after it started",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("a", history.Write, v(2), history.Info, 2, 100),
+				operation("b", history.Read, v(2), history.Ok, 5, 6),
+				operation("b", history.Read, v(1), history.Ok, 7, 8),
+			},
+		},
+		{
+			name: "a pending write seen, and then an older value",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Info, 0, 100),
+				operation("a", history.Write, v(2), history.Ok, 2, 3),
+				operation("b", history.Read, v(1), history.Ok, 5, 6),
+			},
+		},
+		{
+			name: "a failed write never counts",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("a", history.Write, v(2), history.Fail, 2, 3),
+				operation("b", history.Read, v(1), history.Ok, 4, 5),
+			},
+		},
+		{
+			name: "a value written twice can't tell",
+			ops: []*history.Operation{
+				operation("a", history.Write, v(1), history.Ok, 0, 1),
+				operation("a", history.Write, v(2), history.Ok, 2, 3),
+				operation("c", history.Write, v(1), history.Ok, 4, 5),
+				operation("b", history.Read, v(1), history.Ok, 6, 7),
+			},
+		},
+	}
+	for _, tt := range tests {
+		stale, lost := registerAnomalies(tt.ops)
+		if len(stale) != tt.stale || len(lost) != tt.lost {
+			t.Errorf("%s: expected %d stale and %d lost, got %d and %d", tt.name, tt.stale, tt.lost, len(stale), len(lost))
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package analyze
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+)
+
+// what the operations on a key do, for the linearizability checker
+type Model struct {
+	Name  string
+	Init  string
+	Funcs []string
+	// whether the operation is possible in the state, and the state after it
+	Step func(state string, op *history.Operation) (bool, string)
+	// whether leaving the operation out of a counterexample can't make up a violation
+	Removable func(op *history.Operation, ops []*history.Operation) bool
+}
+
+// a key that's written and read, like the probes do
+// a missing key and a value are told apart by the prefix
+var Register = Model{
+	Name:  "register",
+	Funcs: []string{history.Read, history.Write},
+	Step: func(state string, op *history.Operation) (bool, string) {
+		if op.F == history.Write {
+			return true, "=" + *op.Value
+		}
+		return state == registerState(op.Value), state
+	},
+	// the reads only add constraints, and so do the writes nobody read
+	Removable: func(op *history.Operation, ops []*history.Operation) bool {
+		if op.F == history.Read {
+			return true
+		}
+		for _, o := range ops {
+			if o.F == history.Read && o.Value != nil && *o.Value == *op.Value {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+func registerState(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return "=" + *v
+}
+
+// a key that's incremented, by the value of the incr, and read, or returned by the incr
+// the count it starts at is unknown, like for keys left over by an earlier run,
+// and the first operation that tells sets it
+var Counter = Model{
+	Name:  "counter",
+	Funcs: []string{history.Read, history.Incr},
+	Step: func(state string, op *history.Operation) (bool, string) {
+		n, err := strconv.ParseInt(state, 10, 64)
+		known := err == nil
+		if op.F == history.Incr {
+			by, _ := strconv.ParseInt(*op.Value, 10, 64)
+			if op.Result != nil {
+				result, _ := strconv.ParseInt(*op.Result, 10, 64)
+				return !known || result == n+by, *op.Result
+			}
+			if !known {
+				return true, state
+			}
+			return true, strconv.FormatInt(n+by, 10)
+		}
+		read := int64(0)
+		if op.Value != nil {
+			read, _ = strconv.ParseInt(*op.Value, 10, 64)
+		}
+		return !known || read == n, strconv.FormatInt(read, 10)
+	},
+	// the increments all add up in the reads
+	Removable: func(op *history.Operation, ops []*history.Operation) bool {
+		return op.F == history.Read
+	},
+}
+
+var Models = map[string]Model{
+	Register.Name: Register,
+	Counter.Name:  Counter,
+}
+
+// whether the operations on a key are linearizable
+type KeyLinearizability struct {
+	Key        string
+	Operations int
+	// false when it couldn't tell in time
+	Checked      bool
+	Linearizable bool
+	// the fewest operations still impossible to linearize
+	Counterexample []*history.Operation
+}
+
+// a call of the checker: an operation, and whether it's known to have completed
+type call struct {
+	op      *history.Operation
+	pending bool
+}
+
+// checks every key on its own, which is enough for linearizability, in the given time
+func Linearizable(ctx context.Context, model Model, operations []*history.Operation, timeout time.Duration) []*KeyLinearizability {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res := []*KeyLinearizability{}
+	keys := ByKey(operations)
+	names := []string{}
+	for k := range keys {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	for _, k := range names {
+		calls := modelCalls(model, keys[k])
+		if len(calls) == 0 {
+			continue
+		}
+		kl := &KeyLinearizability{Key: k, Operations: len(calls)}
+		res = append(res, kl)
+		ok, err := checkCalls(ctx, model, calls)
+		if err != nil {
+			continue
+		}
+		kl.Checked = true
+		kl.Linearizable = ok
+		if ok {
+			continue
+		}
+		counterexample, err := minimise(ctx, model, calls)
+		if err != nil {
+			// not minimal, but still a violation
+			counterexample = calls
+		}
+		// the ones cut short complete as they did, which only makes it stricter
+		for _, c := range counterexample {
+			kl.Counterexample = append(kl.Counterexample, c.op)
+		}
+	}
+	return res
+}
+
+// the operations the model cares about, in the order they were invoked
+// the failed ones didn't happen, and the reads of unknown outcome say nothing
+func modelCalls(model Model, ops []*history.Operation) []call {
+	calls := []call{}
+	for _, o := range ops {
+		if !slices.Contains(model.Funcs, o.F) || o.Type == history.Fail {
+			continue
+		}
+		if o.F != history.Read && o.Value == nil {
+			continue
+		}
+		if o.Type != history.Ok && o.F == history.Read {
+			continue
+		}
+		calls = append(calls, call{op: o, pending: o.Type != history.Ok})
+	}
+	return calls
+}
+
+// the history cut when the k-th call was invoked; whatever completed later is pending
+func prefix(calls []call, k int) []call {
+	cut := calls[k-1].op.Invoke
+	res := make([]call, k)
+	for i, c := range calls[:k] {
+		res[i] = c
+		if c.op.Complete > cut {
+			res[i].pending = true
+		}
+	}
+	return res
+}
+
+// shrinks a violation to the shortest prefix still impossible to linearize,
+// and then leaves out every operation it can
+func minimise(ctx context.Context, model Model, calls []call) ([]call, error) {
+	lo, hi := 1, len(calls)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		ok, err := checkCalls(ctx, model, prefix(calls, mid))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	res := prefix(calls, lo)
+	// the violation is in the last call, so keep it
+	for i := len(res) - 2; i >= 0; i-- {
+		ops := []*history.Operation{}
+		for j, c := range res {
+			if j != i {
+				ops = append(ops, c.op)
+			}
+		}
+		if !model.Removable(res[i].op, ops) {
+			continue
+		}
+		without := slices.Delete(slices.Clone(res), i, i+1)
+		ok, err := checkCalls(ctx, model, without)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			res = without
+		}
+	}
+	return res, nil
+}
+
+// an entry of the list the checker walks: the call or the return of an operation
+type entry struct {
+	id     int
+	call   *call
+	time   time.Duration
+	isCall bool
+	match  *entry
+	prev   *entry
+	next   *entry
+}
+
+// the algorithm of Wing & Gong, with the cache of Lowe, as in Porcupine:
+// keep linearizing the calls that can go next, backtracking when a return comes before its call was linearized
+func checkCalls(ctx context.Context, model Model, calls []call) (bool, error) {
+	entries := []*entry{}
+	for i := range calls {
+		c := &calls[i]
+		ret := c.op.Complete
+		if c.pending {
+			ret = math.MaxInt64
+		}
+		e := &entry{id: i, call: c, time: c.op.Invoke, isCall: true}
+		e.match = &entry{id: i, time: ret, match: e}
+		entries = append(entries, e, e.match)
+	}
+	// the calls first on a tie, which is the benefit of the doubt
+	slices.SortStableFunc(entries, func(a, b *entry) int {
+		if a.time == b.time {
+			if a.isCall == b.isCall {
+				return 0
+			}
+			if a.isCall {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.time, b.time)
+	})
+	head := &entry{}
+	prev := head
+	for _, e := range entries {
+		prev.next = e
+		e.prev = prev
+		prev = e
+	}
+
+	type frame struct {
+		e     *entry
+		state string
+	}
+	stack := []frame{}
+	linearized := make([]uint64, (len(calls)+63)/64)
+	cache := map[string]bool{}
+	state := model.Init
+	e := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps%1024 == 0 && ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if e.isCall {
+			ok, next := model.Step(state, e.call.op)
+			if ok {
+				linearized[e.id/64] |= 1 << (e.id % 64)
+				key := cacheKey(linearized, next)
+				if !cache[key] {
+					cache[key] = true
+					stack = append(stack, frame{e: e, state: state})
+					state = next
+					lift(e)
+					e = head.next
+					continue
+				}
+				linearized[e.id/64] &^= 1 << (e.id % 64)
+			}
+			e = e.next
+			continue
+		}
+		// a return, before its call could be linearized
+		if len(stack) == 0 {
+			return false, nil
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		state = top.state
+		linearized[top.e.id/64] &^= 1 << (top.e.id % 64)
+		unlift(top.e)
+		e = top.e.next
+	}
+	return true, nil
+}
+
+func cacheKey(linearized []uint64, state string) string {
+	b := make([]byte, 0, len(linearized)*8+len(state))
+	for _, w := range linearized {
+		b = binary.LittleEndian.AppendUint64(b, w)
+	}
+	return string(append(b, state...))
+}
+
+// takes the call and its return out of the list
+func lift(e *entry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+// puts them back
+func unlift(e *entry) {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
@@ -0,0 +1,96 @@
+package analyze
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+)
+
+// a completed call, or a pending one when complete is negative
+func modelCall(f string, value *string, invoke, complete int) call {
+	typ := history.Ok
+	if complete < 0 {
+		typ = history.Info
+		complete = math.MaxInt32
+	}
+	return call{op: operation("p", f, value, typ, invoke, complete), pending: typ != history.Ok}
+}
+
+// an incr by 1, returning the result, or nothing when pending
+func incr(result, invoke, complete int) call {
+	c := modelCall(history.Incr, history.Value(1), invoke, complete)
+	if !c.pending {
+		c.op.Result = history.Value(result)
+	}
+	return c
+}
+
+func TestCheckCalls(t *testing.T) {
+	v := history.Value
+	w := func(value, invoke, complete int) call { return modelCall(history.Write, v(value), invoke, complete) }
+	r := func(value, invoke, complete int) call { return modelCall(history.Read, v(value), invoke, complete) }
+	tests := []struct {
+		name         string
+		model        Model
+		calls        []call
+		linearizable bool
+	}{
+		{"read after write", Register, []call{w(1, 0, 1), r(1, 2, 3)}, true},
+		{"read of the missing key", Register, []call{modelCall(history.Read, nil, 0, 1), w(1, 2, 3)}, true},
+		{"missing after a write", Register, []call{w(1, 0, 1), modelCall(history.Read, nil, 2, 3)}, false},
+		{"stale read", Register, []call{w(1, 0, 1), w(2, 2, 3), r(1, 4, 5)}, false},
+		{"concurrent write seen or not", Register, []call{w(1, 0, 1), w(2, 2, 10), r(1, 3, 4), r(2, 5, 6), r(2, 7, 8)}, true},
+		{"back in time", Register, []call{w(1, 0, 1), w(2, 2, 10), r(2, 3, 4), r(1, 5, 6)}, false},
+		{"pending write seen", Register, []call{w(1, 0, 1), w(2, 2, -1), r(1, 3, 4), r(2, 5, 6)}, true},
+		{"pending write never seen", Register, []call{w(1, 0, 1), w(2, 2, -1), r(1, 10, 11)}, true},
+		{"pending write seen, and then not", Register, []call{w(1, 0, 1), w(2, 2, -1), r(2, 3, 4), r(1, 5, 6)}, false},
+		{"incrs from an unknown count", Counter, []call{incr(41, 0, 1), incr(42, 2, 3), r(42, 4, 5)}, true},
+		{"the same count twice", Counter, []call{incr(5, 0, 1), incr(5, 2, 3)}, false},
+		{"concurrent incrs in either order", Counter, []call{incr(2, 0, 10), incr(1, 1, 5), r(2, 11, 12)}, true},
+		{"a read missing an incr", Counter, []call{incr(1, 0, 1), incr(2, 2, 3), r(1, 4, 5)}, false},
+		{"pending incr seen", Counter, []call{incr(1, 0, 1), incr(0, 2, -1), r(2, 3, 4)}, true},
+		{"pending incr counted twice", Counter, []call{incr(1, 0, 1), incr(0, 2, -1), r(3, 3, 4)}, false},
+		{"the missing key reads as 0", Counter, []call{modelCall(history.Read, nil, 0, 1), incr(1, 2, 3)}, true},
+	}
+	for _, tt := range tests {
+		ok, err := checkCalls(context.Background(), tt.model, tt.calls)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if ok != tt.linearizable {
+			t.Errorf("%s: expected linearizable %v, got %v", tt.name, tt.linearizable, ok)
+		}
+	}
+}
+
+func TestMinimise(t *testing.T) {
+	v := history.Value
+	calls := []call{
+		modelCall(history.Write, v(0), 0, 1),
+		modelCall(history.Read, v(0), 2, 3),
+		modelCall(history.Write, v(1), 4, 5),
+		modelCall(history.Write, v(2), 6, 7),
+		// stale
+		modelCall(history.Read, v(1), 8, 9),
+		modelCall(history.Write, v(3), 10, 11),
+		modelCall(history.Read, v(3), 12, 13),
+	}
+	res, err := minimise(context.Background(), Register, calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, c := range res {
+		got = append(got, c.op.F+" "+*c.op.Value)
+	}
+	want := []string{"write 1", "write 2", "read 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if ok, _ := checkCalls(context.Background(), Register, res); ok {
+		t.Errorf("the counterexample is linearizable")
+	}
+}
@@ -0,0 +1,125 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// collects files into a directory, or a .tar.gz archive, depending on the path
+// and writes an index.json listing all of them on Close
+type Writer struct {
+	Path string
+
+	index []map[string]string
+	file  *os.File
+	gz    *gzip.Writer
+	tar   *tar.Writer
+}
+
+func IsArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+func NewWriter(path string) (*Writer, error) {
+	w := &Writer{Path: path}
+	if !IsArchive(path) {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return nil, fmt.Errorf("can't create %s; got %s", path, err)
+		}
+		return w, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't create %s; got %s", path, err)
+	}
+	w.file = f
+	w.gz = gzip.NewWriter(f)
+	w.tar = tar.NewWriter(w.gz)
+	return w, nil
+}
+
+// prefix for the paths inside the archive, so that it unpacks into a directory
+func (w *Writer) root() string {
+	base := filepath.Base(w.Path)
+	return strings.TrimSuffix(strings.TrimSuffix(base, ".tar.gz"), ".tgz")
+}
+
+// adds a file, and describes it in the index
+func (w *Writer) Add(name string, data []byte, description string) error {
+	w.index = append(w.index, map[string]string{
+		"file":        name,
+		"size":        fmt.Sprint(len(data)),
+		"description": description,
+	})
+	if w.tar == nil {
+		path := filepath.Join(w.Path, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0o644)
+	}
+	err := w.tar.WriteHeader(&tar.Header{
+		Name:    w.root() + "/" + name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tar.Write(data)
+	return err
+}
+
+func (w *Writer) AddJSON(name string, v any, description string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return w.Add(name, data, description)
+}
+
+// records a file we failed to collect, so the gaps are visible in the index
+func (w *Writer) AddError(name string, err error) {
+	w.index = append(w.index, map[string]string{
+		"file":  name,
+		"error": err.Error(),
+	})
+}
+
+// the index, sorted by file name
+func (w *Writer) Index() []map[string]string {
+	index := append([]map[string]string{}, w.index...)
+	sort.SliceStable(index, func(i, j int) bool {
+		return index[i]["file"] < index[j]["file"]
+	})
+	return index
+}
+
+// writes the index, and finishes the archive
+func (w *Writer) Close() error {
+	data, err := json.MarshalIndent(w.Index(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.Add("index.json", data, "this index"); err != nil {
+		return err
+	}
+	if w.tar == nil {
+		return nil
+	}
+	if err := w.tar.Close(); err != nil {
+		return err
+	}
+	if err := w.gz.Close(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,179 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// a connection to one of the nodes reads are served from
+type Reader struct {
+	Name   string
+	Client *redis.Client
+}
+
+// writes increasing versions to a key per client, and reads each of them back from the replicas right away
+// any read returning an older version is stale, and how many versions behind it was is the staleness
+type StaleReads struct {
+	Writer  *redis.Client
+	Readers []*Reader
+	Clients int
+	// per client, 0 for as many as fit in the context
+	Operations int
+	KeyPrefix  string
+	// every client reads from all the readers, rather than one of them
+	ReadAll bool
+}
+
+type StaleReadsResult struct {
+	Client    string
+	Key       string
+	Readers   []string
+	Writes    int
+	Reads     int
+	Stale     int
+	Errors    int
+	MaxBehind int64
+	// versions behind -> reads
+	Behind map[int64]int
+}
+
+func (r *StaleReadsResult) StaleRate() float64 {
+	if r.Reads == 0 {
+		return 0
+	}
+	return float64(r.Stale) / float64(r.Reads)
+}
+
+// which readers the client reads from
+func (s *StaleReads) readersFor(client int) []*Reader {
+	if s.ReadAll || len(s.Readers) == 0 {
+		return s.Readers
+	}
+	return []*Reader{s.Readers[client%len(s.Readers)]}
+}
+
+// runs all the clients until they're done with their operations, or the context is done
+func (s *StaleReads) Run(ctx context.Context) ([]*StaleReadsResult, error) {
+	results := make([]*StaleReadsResult, s.Clients)
+	for i := range s.Clients {
+		results[i] = &StaleReadsResult{
+			Client: fmt.Sprintf("client_%d", i),
+			Key:    fmt.Sprintf("%sclient_%d", s.KeyPrefix, i),
+			Behind: map[int64]int{},
+		}
+		for _, r := range s.readersFor(i) {
+			results[i].Readers = append(results[i].Readers, r.Name)
+		}
+	}
+	// an interrupted run leaves its keys behind, at versions ahead of the ones about to be written
+	if err := s.Cleanup(ctx, results); err != nil {
+		return nil, fmt.Errorf("deleting the keys left over from an earlier run: %w", err)
+	}
+	var wg sync.WaitGroup
+	for i, res := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runClient(ctx, res, s.readersFor(i))
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (s *StaleReads) runClient(ctx context.Context, res *StaleReadsResult, readers []*Reader) {
+	for version := int64(1); s.Operations == 0 || version <= int64(s.Operations); version++ {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.Writer.Set(ctx, res.Key, version, 0).Err(); err != nil {
+			res.Errors++
+			continue
+		}
+		res.Writes++
+		for _, r := range readers {
+			val, err := r.Client.Get(ctx, res.Key).Result()
+			var seen int64
+			if err == nil {
+				seen, err = strconv.ParseInt(val, 10, 64)
+			}
+			// not there at all means not even the first version made it
+			if err == redis.Nil {
+				err = nil
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					res.Errors++
+				}
+				continue
+			}
+			// a version ahead of the one just written is left over from an earlier run,
+			// and not deleted on the replica yet, which says nothing about how far behind it is
+			if seen > version {
+				res.Errors++
+				continue
+			}
+			behind := version - seen
+			res.Reads++
+			res.Behind[behind]++
+			if behind > 0 {
+				res.Stale++
+			}
+			res.MaxBehind = max(res.MaxBehind, behind)
+		}
+	}
+}
+
+// deletes the keys written by the clients
+func (s *StaleReads) Cleanup(ctx context.Context, results []*StaleReadsResult) error {
+	keys := []string{}
+	for _, r := range results {
+		keys = append(keys, r.Key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.Writer.Del(ctx, keys...).Err()
+}
+
+type StalenessBucket struct {
+	Name  string
+	Reads int
+}
+
+// the reads grouped by how many versions behind they were, freshest first
+func StalenessHistogram(behind map[int64]int) []*StalenessBucket {
+	buckets := map[int64]*StalenessBucket{}
+	keys := []int64{}
+	for b, n := range behind {
+		key, name := stalenessBucket(b)
+		if _, ok := buckets[key]; !ok {
+			buckets[key] = &StalenessBucket{Name: name}
+			keys = append(keys, key)
+		}
+		buckets[key].Reads += n
+	}
+	slices.Sort(keys)
+	res := []*StalenessBucket{}
+	for _, k := range keys {
+		res = append(res, buckets[k])
+	}
+	return res
+}
+
+// groups the staleness into power of two buckets: 0, 1, 2, 3-4, 5-8, ...
+func stalenessBucket(behind int64) (int64, string) {
+	if behind <= 2 {
+		return behind, fmt.Sprint(behind)
+	}
+	hi := int64(4)
+	for hi < behind {
+		hi *= 2
+	}
+	return hi, fmt.Sprintf("%d-%d", hi/2+1, hi)
+}
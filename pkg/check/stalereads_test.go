@@ -0,0 +1,60 @@
+package check
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStalenessBucket(t *testing.T) {
+	tests := []struct {
+		behind int64
+		key    int64
+		name   string
+	}{
+		{0, 0, "0"},
+		{1, 1, "1"},
+		{2, 2, "2"},
+		{3, 4, "3-4"},
+		{4, 4, "3-4"},
+		{5, 8, "5-8"},
+		{8, 8, "5-8"},
+		{9, 16, "9-16"},
+		{1000, 1024, "513-1024"},
+	}
+	for _, tt := range tests {
+		key, name := stalenessBucket(tt.behind)
+		if key != tt.key || name != tt.name {
+			t.Errorf("%d: expected %d %q, got %d %q", tt.behind, tt.key, tt.name, key, name)
+		}
+	}
+}
+
+func TestStalenessHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		behind map[int64]int
+		want   []StalenessBucket
+	}{
+		{"no reads", map[int64]int{}, []StalenessBucket{}},
+		{"all fresh", map[int64]int{0: 10}, []StalenessBucket{{"0", 10}}},
+		{
+			"freshest first",
+			map[int64]int{2: 3, 0: 100, 1: 7},
+			[]StalenessBucket{{"0", 100}, {"1", 7}, {"2", 3}},
+		},
+		{
+			"grouped",
+			map[int64]int{0: 50, 3: 1, 4: 2, 6: 4, 7: 1, 100: 1},
+			[]StalenessBucket{{"0", 50}, {"3-4", 3}, {"5-8", 5}, {"65-128", 1}},
+		},
+	}
+	for _, tt := range tests {
+		got := []StalenessBucket{}
+		for _, b := range StalenessHistogram(tt.behind) {
+			got = append(got, *b)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// how the writes are made durable, compared by write-loss
+const (
+	// plain writes, acknowledged by the master alone
+	ModeAsync = "async"
+	// every write followed by WAIT
+	ModeWait = "wait"
+	// the master refusing writes without enough replicas, with min-replicas-to-write
+	ModeMinReplicas = "min-replicas"
+)
+
+var WriteLossModes = []string{ModeAsync, ModeWait, ModeMinReplicas}
+
+// keeps appending increasing sequence numbers to a list per client, remembering which of them were acknowledged
+// reading the lists back after a failover tells exactly which acknowledged writes were lost
+type WriteLoss struct {
+	Client    redis.UniversalClient
+	Clients   int
+	KeyPrefix string
+	// pause between the writes of each client
+	Interval time.Duration
+	// after each write, WAIT for this many replicas
+	// and only count the write as acknowledged when they confirm it in time
+	WaitReplicas int
+	WaitTimeout  time.Duration
+
+	mu      sync.Mutex
+	writers []*lossWriter
+}
+
+type write struct {
+	seq     int64
+	time    time.Time
+	latency time.Duration
+	acked   bool
+}
+
+type lossWriter struct {
+	name   string
+	key    string
+	writes []write
+}
+
+type WriteLossResult struct {
+	Client string
+	Key    string
+	Writes int
+	Acked  int
+	Failed int
+	Lost   []int64
+	// writes that failed, but made it anyway
+	UnackedPresent int
+	// when the lost writes were acknowledged
+	FirstLost time.Time
+	LastLost  time.Time
+	// of the acknowledged writes
+	Latencies []time.Duration
+}
+
+func (r *WriteLossResult) LossRate() float64 {
+	if r.Acked == 0 {
+		return 0
+	}
+	return float64(len(r.Lost)) / float64(r.Acked)
+}
+
+// writes until the context is done
+func (w *WriteLoss) Run(ctx context.Context, pq chan map[string]string) {
+	w.mu.Lock()
+	w.writers = []*lossWriter{}
+	for i := range w.Clients {
+		w.writers = append(w.writers, &lossWriter{
+			name: fmt.Sprintf("client_%d", i),
+			key:  fmt.Sprintf("%sclient_%d", w.KeyPrefix, i),
+		})
+	}
+	w.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, lw := range w.writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.runWriter(ctx, lw, pq)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *WriteLoss) runWriter(ctx context.Context, lw *lossWriter, pq chan map[string]string) {
+	failing := false
+	for seq := int64(1); ctx.Err() == nil; seq++ {
+		start := time.Now()
+		err := w.write(ctx, lw.key, seq)
+		latency := time.Since(start)
+		if ctx.Err() != nil && err != nil {
+			// cut short by the end of the run, rather than the failure
+			return
+		}
+		w.mu.Lock()
+		lw.writes = append(lw.writes, write{seq: seq, time: start, latency: latency, acked: err == nil})
+		w.mu.Unlock()
+		if (err != nil) != failing {
+			failing = err != nil
+			evt := map[string]string{
+				"debug":  "true",
+				"event":  "writes recovered",
+				"client": lw.name,
+				"msg":    fmt.Sprint(seq),
+			}
+			if failing {
+				evt["event"] = "writes failing"
+				evt["error"] = err.Error()
+			}
+			pq <- evt
+		}
+		if w.Interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.Interval):
+			}
+		}
+	}
+}
+
+func (w *WriteLoss) write(ctx context.Context, key string, seq int64) error {
+	if w.WaitReplicas <= 0 {
+		return w.Client.RPush(ctx, key, seq).Err()
+	}
+	// WAIT is about the writes on the same connection, which the pipeline guarantees
+	wait := redis.NewIntCmd(ctx, "wait", w.WaitReplicas, w.WaitTimeout.Milliseconds())
+	_, err := w.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.RPush(ctx, key, seq)
+		return p.Process(ctx, wait)
+	})
+	if err != nil {
+		return err
+	}
+	if n := wait.Val(); n < int64(w.WaitReplicas) {
+		return fmt.Errorf("only %d of %d replicas confirmed the write", n, w.WaitReplicas)
+	}
+	return nil
+}
+
+// reads the lists back, and compares them with what was acknowledged
+func (w *WriteLoss) Verify(ctx context.Context) ([]*WriteLossResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	results := []*WriteLossResult{}
+	for _, lw := range w.writers {
+		values, err := w.Client.LRange(ctx, lw.key, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("can't read %s back; got %s", lw.key, err)
+		}
+		present := map[int64]bool{}
+		for _, v := range values {
+			seq, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected value %q in %s", v, lw.key)
+			}
+			present[seq] = true
+		}
+		res := &WriteLossResult{
+			Client: lw.name,
+			Key:    lw.key,
+			Writes: len(lw.writes),
+			Lost:   []int64{},
+		}
+		for _, wr := range lw.writes {
+			switch {
+			case wr.acked && !present[wr.seq]:
+				res.Lost = append(res.Lost, wr.seq)
+				if res.FirstLost.IsZero() {
+					res.FirstLost = wr.time
+				}
+				res.LastLost = wr.time
+				res.Acked++
+				res.Latencies = append(res.Latencies, wr.latency)
+			case wr.acked:
+				res.Acked++
+				res.Latencies = append(res.Latencies, wr.latency)
+			case present[wr.seq]:
+				res.Failed++
+				res.UnackedPresent++
+			default:
+				res.Failed++
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// deletes the lists written by the clients
+func (w *WriteLoss) Cleanup(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	keys := []string{}
+	for _, lw := range w.writers {
+		keys = append(keys, lw.key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return w.Client.Del(ctx, keys...).Err()
+}
+
+// formats sequence numbers like 1-5,8,10-11
+func FormatRanges(seqs []int64) string {
+	parts := []string{}
+	for i := 0; i < len(seqs); {
+		j := i
+		for j+1 < len(seqs) && seqs[j+1] == seqs[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprint(seqs[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", seqs[i], seqs[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
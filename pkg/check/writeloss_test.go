@@ -0,0 +1,22 @@
+package check
+
+import "testing"
+
+func TestFormatRanges(t *testing.T) {
+	tests := []struct {
+		seqs []int64
+		want string
+	}{
+		{nil, ""},
+		{[]int64{7}, "7"},
+		{[]int64{1, 2, 3, 4, 5}, "1-5"},
+		{[]int64{1, 2, 3, 4, 5, 8, 10, 11}, "1-5,8,10-11"},
+		{[]int64{2, 4, 6}, "2,4,6"},
+		{[]int64{1, 2, 4, 5}, "1-2,4-5"},
+	}
+	for _, tt := range tests {
+		if got := FormatRanges(tt.seqs); got != tt.want {
+			t.Errorf("%v: expected %q, got %q", tt.seqs, tt.want, got)
+		}
+	}
+}
@@ -3,16 +3,110 @@ package config
 import "time"
 
 type RRConfig struct {
-	Verbose bool
-	Pretty  bool
-	Format  string
+	Verbose    bool
+	Pretty     bool
+	Format     string
+	Experiment string
 
-	Kubeconfig string
-	Namespace  string
+	Kubeconfig   string
+	Context      string
+	Contexts     []string
+	Namespace    string
+	LockDuration time.Duration
+
+	Collect         string
+	CollectSelector string
 
 	Timeout time.Duration
 	Grace   time.Duration
 
 	SentinelURL    string
 	SentinelMaster string
+	RedisURL       string
+
+	StepTimeout    time.Duration
+	RolloutTimeout time.Duration
+	StatefulSet    string
+
+	PartitionMode     string
+	PartitionDuration time.Duration
+	ObserveAfter      time.Duration
+	SentinelSelector  string
+	SplitBrainEvery   time.Duration
+
+	RBACName string
+	RBACFor  []string
+	Image    string
+	Schedule string
+	Secret   string
+
+	ProbeKey      string
+	ProbeInterval time.Duration
+	ProbeSlow     time.Duration
+	ProbeTimeout  time.Duration
+	HistoryFile   string
+	ClientProbe   bool
+	ProbePinned   bool
+	ProbeSettle   time.Duration
+	Strategies    []string
+	ServiceAddr   string
+	ClientRetries int
+
+	Resync time.Duration
+
+	Clients       int
+	Operations    int
+	CheckDuration time.Duration
+	KeyPrefix     string
+	ReadFrom      []string
+	WriteTo       string
+
+	LossClients       int
+	LossKeyPrefix     string
+	LossInterval      time.Duration
+	VerifyTimeout     time.Duration
+	LossModes         []string
+	FailoverAfter     time.Duration
+	WaitReplicas      int
+	WaitTimeout       time.Duration
+	MinReplicas       int
+	MinReplicasMaxLag time.Duration
+
+	LoadMix       []string
+	LoadClients   int
+	LoadRate      int
+	LoadKeys      int
+	LoadKeyPrefix string
+	ValueSize     int
+	PipelineSize  int
+
+	SeedKeys      int
+	SeedPrefix    string
+	SeedTypes     []string
+	SeedValueSize string
+	SeedElements  string
+	TTLFraction   float64
+	TTL           time.Duration
+	SeedBatch     int
+	SeedClients   int
+	Cleanup       bool
+
+	Match           string
+	ScanCount       int
+	Digest          string
+	Rechecks        int
+	RecheckInterval time.Duration
+
+	Examples     int
+	Model        string
+	ModelTimeout time.Duration
+
+	BundleFile string
+	SkipKube   bool
+
+	WithPVC         bool
+	RecordEvents    bool
+	WaitRecovery    bool
+	RecoveryTimeout time.Duration
+	MaxLag          int64
 }
@@ -0,0 +1,314 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// the types of operations in a history
+const (
+	// a client is about to issue the operation
+	Invoke = "invoke"
+	// it definitely happened
+	Ok = "ok"
+	// it definitely didn't happen, like when the server replied with an error
+	Fail = "fail"
+	// it may or may not have happened, like on a timeout
+	// also used for notes about the recording itself, without a process
+	Info = "info"
+)
+
+// the functions of the operations the analysis understands
+// anything else is only counted towards the availability and the latencies
+const (
+	Read  = "read"
+	Write = "write"
+	// adds the value to the key
+	Incr = "incr"
+)
+
+// a line of the history
+type Op struct {
+	Index   int64  `json:"index"`
+	Type    string `json:"type"`
+	Process string `json:"process,omitempty"`
+	F       string `json:"f"`
+	Key     string `json:"key,omitempty"`
+	// nil for the reads of a missing key
+	Value *string `json:"value"`
+	// what an incr returned, on its completion
+	Result *string `json:"result,omitempty"`
+	// since the recording started, from a monotonic clock
+	Time  time.Duration `json:"time"`
+	Error string        `json:"error,omitempty"`
+}
+
+func (o Op) String() string {
+	v := "nil"
+	if o.Value != nil {
+		v = *o.Value
+	}
+	s := fmt.Sprintf("%d %s %s %s %s=%s at %s", o.Index, o.Process, o.Type, o.F, o.Key, v, o.Time)
+	if o.Result != nil {
+		s += " -> " + *o.Result
+	}
+	if o.Error != "" {
+		s += " (" + o.Error + ")"
+	}
+	return s
+}
+
+// a pointer to the value, for the Value of an Op
+func Value(v any) *string {
+	s := fmt.Sprint(v)
+	return &s
+}
+
+// writes the operations of the clients to an NDJSON file, safe for concurrent use
+// all the methods of a nil Recorder do nothing, so that recording can be optional
+type Recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	start time.Time
+	index int64
+	// the first error writing, returned by Close
+	err error
+	// so that a crash loses no more than this much
+	flushed time.Time
+}
+
+// how often the buffered operations are written out
+const flushInterval = time.Second
+
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	r := &Recorder{
+		file:  f,
+		w:     w,
+		enc:   json.NewEncoder(w),
+		start: time.Now(),
+	}
+	r.flushed = r.start
+	// the wall clock, to line the history up with everything else
+	r.write(Op{Type: Info, F: "start", Value: Value(r.start.Format(time.RFC3339Nano))})
+	return r, nil
+}
+
+func (r *Recorder) write(op Op) Op {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	op.Index = r.index
+	r.index++
+	if op.Time == 0 {
+		op.Time = time.Since(r.start)
+	}
+	if err := r.enc.Encode(op); err != nil {
+		r.fail(err)
+	}
+	if (op.Type == Info && op.Process == "") || time.Since(r.flushed) >= flushInterval {
+		r.flush()
+	}
+	return op
+}
+
+func (r *Recorder) flush() {
+	if err := r.w.Flush(); err != nil {
+		r.fail(err)
+	}
+	r.flushed = time.Now()
+}
+
+// keeps the first error only, the others likely follow from it
+func (r *Recorder) fail(err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("can't write the history to %s; got %s", r.file.Name(), err)
+	}
+}
+
+// records that the process is about to issue the operation, and returns it, to Complete it later
+func (r *Recorder) Invoke(process, f, key string, value *string) Op {
+	if r == nil {
+		return Op{}
+	}
+	return r.write(Op{
+		Type:    Invoke,
+		Process: process,
+		F:       f,
+		Key:     key,
+		Value:   value,
+	})
+}
+
+// records how the invoked operation went; the value is what a read, or an incr, returned
+func (r *Recorder) Complete(invoke Op, value *string, err error) {
+	if r == nil {
+		return
+	}
+	op := invoke
+	op.Type = Ok
+	op.Time = 0
+	// the value of an incr is how much it added
+	if value != nil && op.F == Incr {
+		op.Result = value
+	} else if value != nil {
+		op.Value = value
+	}
+	if err != nil {
+		op.Type = Outcome(err)
+		op.Error = err.Error()
+	}
+	r.write(op)
+}
+
+// records something that happened meanwhile, like a failover, and writes out everything so far
+func (r *Recorder) Note(f, msg string) {
+	if r == nil {
+		return
+	}
+	r.write(Op{Type: Info, F: f, Value: Value(msg)})
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flush()
+	if err := r.file.Close(); err != nil {
+		r.fail(err)
+	}
+	return r.err
+}
+
+// whether the failed operation definitely didn't happen, or might have
+func Outcome(err error) string {
+	var rerr redis.Error
+	// the server refused it, or it never got there
+	if errors.As(err, &rerr) || errors.Is(err, syscall.ECONNREFUSED) {
+		return Fail
+	}
+	return Info
+}
+
+// reads a history written by a Recorder
+func ReadOps(r io.Reader) ([]Op, error) {
+	ops := []Op{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var op Op
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, scanner.Err()
+}
+
+func ReadFile(path string) ([]Op, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadOps(f)
+}
+
+// an operation from its invocation to its completion
+type Operation struct {
+	Process string
+	F       string
+	Key     string
+	// what was written, or read, or added
+	Value *string
+	// what an incr returned
+	Result   *string
+	Type     string
+	Error    string
+	Invoke   time.Duration
+	Complete time.Duration
+	// of the invoke and the completion in the history
+	InvokeIndex   int64
+	CompleteIndex int64
+}
+
+func (o *Operation) Latency() time.Duration {
+	return o.Complete - o.Invoke
+}
+
+func (o *Operation) String() string {
+	v := "nil"
+	if o.Value != nil {
+		v = *o.Value
+	}
+	s := fmt.Sprintf("%s %s %s=%s [%s, %s] %s", o.Process, o.F, o.Key, v, o.Invoke, o.Complete, o.Type)
+	if o.Result != nil {
+		s += " -> " + *o.Result
+	}
+	return s
+}
+
+// pairs the invocations with their completions, the next operation of the same process
+// the ones never completed are left as info, completing at the end of the history
+func Pair(ops []Op) []*Operation {
+	pending := map[string]*Operation{}
+	res := []*Operation{}
+	var end time.Duration
+	for _, op := range ops {
+		end = max(end, op.Time)
+		if op.Process == "" {
+			continue
+		}
+		if op.Type == Invoke {
+			o := &Operation{
+				Process:     op.Process,
+				F:           op.F,
+				Key:         op.Key,
+				Value:       op.Value,
+				Type:        Info,
+				Invoke:      op.Time,
+				InvokeIndex: op.Index,
+			}
+			pending[op.Process] = o
+			res = append(res, o)
+			continue
+		}
+		o, ok := pending[op.Process]
+		if !ok {
+			continue
+		}
+		delete(pending, op.Process)
+		o.Type = op.Type
+		o.Error = op.Error
+		o.Complete = op.Time
+		o.CompleteIndex = op.Index
+		if op.Value != nil {
+			o.Value = op.Value
+		}
+		o.Result = op.Result
+	}
+	for _, o := range pending {
+		o.Complete = end
+		o.CompleteIndex = -1
+	}
+	return res
+}
@@ -0,0 +1,55 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.ndjson")
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoke := r.Invoke("probe", Write, "k", Value(1))
+	r.Complete(invoke, nil, nil)
+	r.Note("failover", "10.0.0.2:6379")
+	// the notes are written out right away
+	ops, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 4 {
+		t.Fatalf("expected 4 ops before closing, got %d", len(ops))
+	}
+	invoke = r.Invoke("probe", Read, "k", nil)
+	r.Complete(invoke, Value(1), errors.New("i/o timeout"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ops, err = ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 6 || ops[5].Type != Info || ops[5].Index != 5 || *ops[5].Value != "1" {
+		t.Errorf("unexpected history %v", ops)
+	}
+}
+
+func TestRecorderKeepsTheFirstError(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "history.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.file.Close()
+	r.Note("failover", "10.0.0.2:6379")
+	r.Invoke("probe", Write, "k", Value(1))
+	if err := r.Close(); err == nil {
+		t.Errorf("expected the write error")
+	}
+	var none *Recorder
+	if err := none.Close(); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
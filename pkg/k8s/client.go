@@ -3,12 +3,15 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/tools/cache"
@@ -16,10 +19,23 @@ import (
 	twatch "k8s.io/client-go/tools/watch"
 )
 
-func GetClient(kubeconfig string) (*kubernetes.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// loads the config like kubectl does: from the kubeconfig path(s) or ~/.kube/config,
+// optionally using a different context, and falls back to in-cluster config when there's none
+func ClientConfig(kubeconfig, kubecontext string) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if paths := filepath.SplitList(kubeconfig); len(paths) > 1 {
+		rules.Precedence = paths
+	} else {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubecontext}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+func GetClient(kubeconfig, kubecontext string) (*kubernetes.Clientset, error) {
+	config, err := ClientConfig(kubeconfig, kubecontext).ClientConfig()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("can't load Kubernetes config; got %s", err)
 	}
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -28,29 +44,42 @@ func GetClient(kubeconfig string) (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
-// tries to load the current workspace
-func DeriveNamespace(namespace string) string {
+// for the custom resources, which have no typed client
+func GetDynamicClient(kubeconfig, kubecontext string) (dynamic.Interface, error) {
+	config, err := ClientConfig(kubeconfig, kubecontext).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't load Kubernetes config; got %s", err)
+	}
+	return dynamic.NewForConfig(config)
+}
+
+// uses the namespace if set, otherwise the one from the kubeconfig context,
+// otherwise the one of the service account when running in the cluster
+func DeriveNamespace(namespace, kubeconfig, kubecontext string) (string, error) {
 	if namespace != "" {
-		return namespace
+		return namespace, nil
+	}
+	namespace, _, err := ClientConfig(kubeconfig, kubecontext).Namespace()
+	if err != nil {
+		return "", fmt.Errorf("can't figure out the namespace, set it explicitly; got %s", err)
 	}
-	clientCfg, _ := clientcmd.NewDefaultClientConfigLoadingRules().Load()
-	namespace = clientCfg.Contexts[clientCfg.CurrentContext].Namespace
 	if namespace == "" {
-		return "default"
+		return "default", nil
 	}
-	return namespace
+	return namespace, nil
 }
 
 func GuessPodNameFromHost(hostname string) (string, error) {
 	return strings.Split(hostname, ".")[0], nil
 }
 
-func KeepPodDead(ctx context.Context, clientset *kubernetes.Clientset, name, namespace string, grace int64, done chan error, pq chan map[string]string) {
+func KeepPodDead(ctx context.Context, clientset kubernetes.Interface, name, namespace string, grace int64, done chan error, pq chan map[string]string) {
 	cl := clientset.CoreV1().Pods(namespace)
 	// check the pod exists
 	pod, err := cl.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		done <- fmt.Errorf("can't get the pod %s in %s; got %s", name, namespace, err)
+		return
 	}
 	// setup watch & deletion
 	wf := func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
@@ -80,6 +109,7 @@ func KeepPodDead(ctx context.Context, clientset *kubernetes.Clientset, name, nam
 	wr, err := twatch.NewRetryWatcherWithContext(ctx, pod.ResourceVersion, &cache.ListWatch{WatchFuncWithContext: wf})
 	if err != nil {
 		done <- fmt.Errorf("can't create retry watcher; got %s", err)
+		return
 	}
 	// do the initial delete
 	deletePod(true)
@@ -102,3 +132,91 @@ func KeepPodDead(ctx context.Context, clientset *kubernetes.Clientset, name, nam
 		}
 	}
 }
+
+// deletes the pod gracefully, using its own termination grace period
+func RestartPod(ctx context.Context, clientset kubernetes.Interface, name, namespace string, pq chan map[string]string) error {
+	pq <- map[string]string{
+		"event":     "restarting pod",
+		"msg":       name,
+		"name":      name,
+		"namespace": namespace,
+	}
+	err := clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("error deleting pod %s in %s; got %s", name, namespace, err)
+	}
+	return nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// waits for the pod to be recreated (not terminating), and then to become Ready
+func WaitForPodReady(ctx context.Context, clientset kubernetes.Interface, name, namespace string, done chan error, pq chan map[string]string) {
+	cl := clientset.CoreV1().Pods(namespace)
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	list, err := cl.List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		done <- fmt.Errorf("can't list the pod %s in %s; got %s", name, namespace, err)
+		return
+	}
+	created := false
+	check := func(pod *corev1.Pod) bool {
+		if pod.DeletionTimestamp != nil {
+			return false
+		}
+		if !created {
+			created = true
+			pq <- map[string]string{
+				"event":     "pod recreated",
+				"msg":       name,
+				"name":      name,
+				"namespace": namespace,
+			}
+		}
+		if !isPodReady(pod) {
+			return false
+		}
+		pq <- map[string]string{
+			"event":     "pod ready",
+			"msg":       name,
+			"name":      name,
+			"namespace": namespace,
+		}
+		done <- nil
+		return true
+	}
+	for i := range list.Items {
+		if check(&list.Items[i]) {
+			return
+		}
+	}
+	wf := func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+		options.FieldSelector = selector
+		return cl.Watch(ctx, options)
+	}
+	wr, err := twatch.NewRetryWatcherWithContext(ctx, list.ResourceVersion, &cache.ListWatch{WatchFuncWithContext: wf})
+	if err != nil {
+		done <- fmt.Errorf("can't create retry watcher; got %s", err)
+		return
+	}
+	defer wr.Stop()
+	for event := range wr.ResultChan() {
+		item, ok := event.Object.(*corev1.Pod)
+		if !ok {
+			continue
+		}
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			if check(item) {
+				return
+			}
+		}
+	}
+}
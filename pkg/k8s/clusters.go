@@ -0,0 +1,147 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// one of the clusters the redis deployment runs in
+type Cluster struct {
+	// the kubeconfig context, empty for the current one
+	Context   string
+	Namespace string
+	Client    kubernetes.Interface
+}
+
+func (c *Cluster) String() string {
+	if c.Context == "" {
+		return "current context"
+	}
+	return c.Context
+}
+
+// clients for all the clusters a deployment spans, like sentinels in one and replicas in another
+// the first one is where rr keeps its own state, like the lock
+type Clusters struct {
+	List []*Cluster
+
+	mu    sync.Mutex
+	hosts map[string]*Cluster
+}
+
+// the namespace applies to all the clusters; when empty, each uses the one from its context
+func NewClusters(kubeconfig, namespace string, contexts ...string) (*Clusters, error) {
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	c := &Clusters{hosts: map[string]*Cluster{}}
+	for _, kubecontext := range contexts {
+		client, err := GetClient(kubeconfig, kubecontext)
+		if err != nil {
+			return nil, err
+		}
+		ns, err := DeriveNamespace(namespace, kubeconfig, kubecontext)
+		if err != nil {
+			return nil, err
+		}
+		c.List = append(c.List, &Cluster{
+			Context:   kubecontext,
+			Namespace: ns,
+			Client:    client,
+		})
+	}
+	return c, nil
+}
+
+func (c *Clusters) Primary() *Cluster {
+	return c.List[0]
+}
+
+// finds the cluster running the pod behind the redis host, which is either the pod's DNS name or its IP
+// with a single cluster, that's the one, without asking it
+func (c *Clusters) ForHost(ctx context.Context, host string) (*Cluster, string, error) {
+	if len(c.List) == 1 {
+		name, err := GuessPodNameFromHost(host)
+		return c.Primary(), name, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	type candidate struct {
+		cluster *Cluster
+		pod     *corev1.Pod
+	}
+	candidates := []candidate{}
+	for _, cluster := range c.List {
+		pod, err := cluster.podForHost(ctx, host)
+		if err != nil {
+			return nil, "", err
+		}
+		if pod != nil {
+			candidates = append(candidates, candidate{cluster, pod})
+		}
+	}
+	// the same chart in two clusters gives the pods the same names, so the IP has to tell
+	if len(candidates) > 1 {
+		ips, _ := net.DefaultResolver.LookupHost(ctx, host)
+		matching := []candidate{}
+		for _, cand := range candidates {
+			if slices.Contains(ips, cand.pod.Status.PodIP) {
+				matching = append(matching, cand)
+			}
+		}
+		if len(matching) != 1 {
+			return nil, "", fmt.Errorf("%s matches the pod %s in %s and %s; use IPs in the sentinel config (replica-announce-ip)", host, candidates[0].pod.Name, candidates[0].cluster, candidates[1].cluster)
+		}
+		candidates = matching
+	}
+	if len(candidates) == 1 {
+		c.hosts[host] = candidates[0].cluster
+		return candidates[0].cluster, candidates[0].pod.Name, nil
+	}
+	// the pod might be gone for now, like while it's being killed
+	if cluster, ok := c.hosts[host]; ok {
+		name, err := GuessPodNameFromHost(host)
+		return cluster, name, err
+	}
+	return nil, "", fmt.Errorf("no pod for %s in any of the clusters", host)
+}
+
+// the pod, or nil if it's not in this cluster
+func (c *Cluster) podForHost(ctx context.Context, host string) (*corev1.Pod, error) {
+	pods := c.Client.CoreV1().Pods(c.Namespace)
+	if net.ParseIP(host) != nil {
+		list, err := pods.List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("status.podIP", host).String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't list the pods in %s in %s; got %s", c.Namespace, c, err)
+		}
+		for _, pod := range list.Items {
+			if pod.DeletionTimestamp == nil {
+				return &pod, nil
+			}
+		}
+		return nil, nil
+	}
+	name, err := GuessPodNameFromHost(host)
+	if err != nil {
+		return nil, err
+	}
+	pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get the pod %s in %s in %s; got %s", name, c.Namespace, c, err)
+	}
+	return pod, nil
+}
@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/bundle"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gathers the logs and Kubernetes Events of the experiment window into a bundle
+type Collector struct {
+	Namespace string
+	Start     time.Time
+
+	clientset kubernetes.Interface
+	bundle    *bundle.Writer
+	prefix    string
+}
+
+func NewCollector(clientset kubernetes.Interface, namespace string, start time.Time, w *bundle.Writer) *Collector {
+	return &Collector{
+		Namespace: namespace,
+		Start:     start,
+		clientset: clientset,
+		bundle:    w,
+	}
+}
+
+func (c *Collector) Bundle() *bundle.Writer {
+	return c.bundle
+}
+
+// collects from another cluster into the same bundle, under clusters/<context>/
+func (c *Collector) In(cluster *Cluster) *Collector {
+	return &Collector{
+		Namespace: cluster.Namespace,
+		Start:     c.Start,
+		clientset: cluster.Client,
+		bundle:    c.bundle,
+		prefix:    fmt.Sprintf("clusters/%s/", cluster),
+	}
+}
+
+// the pods of the StatefulSet owning the pod, and the pods matching the selector
+func PodsToCollect(ctx context.Context, clientset kubernetes.Interface, name, namespace, selector string) ([]string, error) {
+	pods := []string{}
+	if name != "" {
+		pods = append(pods, name)
+	}
+	add := func(selector string) error {
+		list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return fmt.Errorf("can't list the pods in %s; got %s", namespace, err)
+		}
+		for _, pod := range list.Items {
+			if !slices.Contains(pods, pod.Name) {
+				pods = append(pods, pod.Name)
+			}
+		}
+		return nil
+	}
+	// the pod might not be in a StatefulSet, which is fine
+	if name != "" {
+		if sts, err := GetStatefulSetForPod(ctx, clientset, name, namespace); err == nil {
+			s, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("bad selector on %s; got %s", sts.Name, err)
+			}
+			if err := add(s.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if selector != "" {
+		if err := add(selector); err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(pods)
+	return pods, nil
+}
+
+func (c *Collector) readLogs(ctx context.Context, pod, container string, previous bool) ([]byte, error) {
+	since := metav1.NewTime(c.Start)
+	stream, err := c.clientset.CoreV1().Pods(c.Namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container:  container,
+		Previous:   previous,
+		SinceTime:  &since,
+		Timestamps: true,
+	}).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return io.ReadAll(stream)
+}
+
+// saves the logs of all the containers of the pod since the start
+// including the previous instance of the containers that restarted
+// the suffix tells apart snapshots of the same pod, like before it was killed
+func (c *Collector) PodLogs(ctx context.Context, name, suffix string) error {
+	pod, err := c.clientset.CoreV1().Pods(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		c.bundle.AddError(fmt.Sprintf("%slogs/%s", c.prefix, name), err)
+		return fmt.Errorf("can't get the pod %s in %s; got %s", name, c.Namespace, err)
+	}
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		file := fmt.Sprintf("%slogs/%s/%s%s.log", c.prefix, name, status.Name, suffix)
+		logs, err := c.readLogs(ctx, name, status.Name, false)
+		if err != nil {
+			c.bundle.AddError(file, err)
+		} else if err := c.bundle.Add(file, logs, fmt.Sprintf("logs of %s in %s (uid %s)", status.Name, name, pod.UID)); err != nil {
+			return err
+		}
+		if status.RestartCount == 0 {
+			continue
+		}
+		file = fmt.Sprintf("%slogs/%s/%s%s.previous.log", c.prefix, name, status.Name, suffix)
+		logs, err = c.readLogs(ctx, name, status.Name, true)
+		if err != nil {
+			c.bundle.AddError(file, err)
+		} else if err := c.bundle.Add(file, logs, fmt.Sprintf("logs of the previous %s in %s (uid %s)", status.Name, name, pod.UID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eventTime(e *corev1.Event) time.Time {
+	for _, t := range []time.Time{e.LastTimestamp.Time, e.EventTime.Time, e.FirstTimestamp.Time, e.CreationTimestamp.Time} {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// saves the Kubernetes Events of the namespace that happened between the start and the end
+func (c *Collector) Events(ctx context.Context, end time.Time) error {
+	list, err := c.clientset.CoreV1().Events(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.bundle.AddError(c.prefix+"events.json", err)
+		return fmt.Errorf("can't list the events in %s; got %s", c.Namespace, err)
+	}
+	events := []map[string]string{}
+	for _, e := range list.Items {
+		t := eventTime(&e)
+		if t.Before(c.Start.Add(-time.Second)) || t.After(end) {
+			continue
+		}
+		events = append(events, map[string]string{
+			"time":    t.Format(time.RFC3339),
+			"type":    e.Type,
+			"reason":  e.Reason,
+			"object":  fmt.Sprintf("%s/%s", e.InvolvedObject.Kind, e.InvolvedObject.Name),
+			"count":   fmt.Sprint(e.Count),
+			"source":  e.Source.Component,
+			"message": e.Message,
+		})
+	}
+	slices.SortStableFunc(events, func(a, b map[string]string) int {
+		if a["time"] < b["time"] {
+			return -1
+		}
+		if a["time"] > b["time"] {
+			return 1
+		}
+		return 0
+	})
+	return c.bundle.AddJSON(c.prefix+"events.json", events, fmt.Sprintf("Kubernetes Events in %s during the experiment", c.Namespace))
+}
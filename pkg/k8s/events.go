@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const ExperimentAnnotation = "rr.seeker89.io/experiment"
+
+// makes up a unique-enough experiment ID
+func NewExperimentID() string {
+	return fmt.Sprintf("rr-%s", time.Now().UTC().Format("20060102-150405.000"))
+}
+
+// records the experiment as Kubernetes Events on the target pod, and the StatefulSet owning it
+// so that whoever investigates the restarts can see rr caused them
+type Recorder struct {
+	Experiment string
+	Pod        string
+	Namespace  string
+
+	clientset kubernetes.Interface
+	objects   []corev1.ObjectReference
+}
+
+func NewRecorder(ctx context.Context, clientset kubernetes.Interface, experiment, name, namespace string) (*Recorder, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't get the pod %s in %s; got %s", name, namespace, err)
+	}
+	r := &Recorder{
+		Experiment: experiment,
+		Pod:        name,
+		Namespace:  namespace,
+		clientset:  clientset,
+		objects: []corev1.ObjectReference{
+			{
+				APIVersion:      "v1",
+				Kind:            "Pod",
+				Name:            pod.Name,
+				Namespace:       pod.Namespace,
+				UID:             pod.UID,
+				ResourceVersion: pod.ResourceVersion,
+			},
+		},
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind != "StatefulSet" {
+			continue
+		}
+		r.objects = append(r.objects, corev1.ObjectReference{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			Namespace:  namespace,
+			UID:        ref.UID,
+		})
+	}
+	return r, nil
+}
+
+// also records the events on another object, like the resource describing the experiment
+func (r *Recorder) AddObject(ref corev1.ObjectReference) {
+	r.objects = append(r.objects, ref)
+}
+
+// marks the target pod with the experiment ID
+func (r *Recorder) Annotate(ctx context.Context) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				ExperimentAnnotation: r.Experiment,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.clientset.CoreV1().Pods(r.Namespace).Patch(ctx, r.Pod, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("can't annotate the pod %s in %s; got %s", r.Pod, r.Namespace, err)
+	}
+	return nil
+}
+
+// creates a Normal event with the reason on the pod and its StatefulSet
+func (r *Recorder) Event(ctx context.Context, reason, message string) error {
+	now := metav1.Now()
+	for _, obj := range r.objects {
+		evt := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: obj.Name + ".rr-",
+				Namespace:    r.Namespace,
+				Annotations: map[string]string{
+					ExperimentAnnotation: r.Experiment,
+				},
+			},
+			InvolvedObject: obj,
+			Reason:         reason,
+			Message:        fmt.Sprintf("%s (experiment %s)", message, r.Experiment),
+			Type:           corev1.EventTypeNormal,
+			Source:         corev1.EventSource{Component: ManagedBy},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if _, err := r.clientset.CoreV1().Events(r.Namespace).Create(ctx, evt, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("can't create event %s for %s; got %s", reason, obj.Name, err)
+		}
+	}
+	return nil
+}
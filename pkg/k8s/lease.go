@@ -0,0 +1,207 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var nonDNS = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// the Lease guarding the redis master in the namespace
+func LockName(master string) string {
+	return "rr-lock-" + strings.Trim(nonDNS.ReplaceAllString(strings.ToLower(master), "-"), "-")
+}
+
+// who's running the experiment, as shown to anyone else trying to run one
+func LockHolder(experiment string) string {
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s@%s (pid %d)", os.Getenv("USER"), host, os.Getpid())
+	if experiment != "" {
+		holder += " " + experiment
+	}
+	return strings.TrimPrefix(holder, "@")
+}
+
+// an exclusive lock on the target, held with a Lease that needs to be renewed
+// if rr dies without releasing it, it expires after the duration
+type Lock struct {
+	Name      string
+	Namespace string
+	Holder    string
+	Duration  time.Duration
+
+	clientset kubernetes.Interface
+	stop      chan bool
+	stopped   chan bool
+	lost      chan bool
+	err       error
+}
+
+// closed when the lock is lost, to someone else or by not renewing it in time, when Err says why
+// whatever the lock guards needs to stop then
+func (l *Lock) Lost() <-chan bool {
+	return l.lost
+}
+
+func (l *Lock) Err() error {
+	select {
+	case <-l.lost:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+func isExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return true
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+// takes the lock, or fails naming whoever holds it; keeps renewing it until released
+func AcquireLock(ctx context.Context, clientset kubernetes.Interface, master, namespace, holder, command string, duration time.Duration) (*Lock, error) {
+	// the lease counts in whole seconds
+	if duration < time.Second {
+		return nil, fmt.Errorf("the lock duration needs to be at least 1s; got %s", duration)
+	}
+	l := &Lock{
+		Name:      LockName(master),
+		Namespace: namespace,
+		Holder:    holder,
+		Duration:  duration,
+		clientset: clientset,
+		stop:      make(chan bool),
+		stopped:   make(chan bool),
+		lost:      make(chan bool),
+	}
+	cl := clientset.CoordinationV1().Leases(namespace)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(math.Ceil(duration.Seconds()))
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &seconds,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+	annotations := map[string]string{
+		"rr.seeker89.io/master":  master,
+		"rr.seeker89.io/command": command,
+	}
+	lease, err := cl.Get(ctx, l.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = cl.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        l.Name,
+				Namespace:   namespace,
+				Annotations: annotations,
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by": ManagedBy,
+				},
+			},
+			Spec: spec,
+		}, metav1.CreateOptions{})
+	case err != nil:
+	case !isExpired(lease, now.Time):
+		return nil, fmt.Errorf(
+			"%s in %s is locked by %s running %q since %s (renewed %s ago); wait for it to finish, or for the lease %s to expire",
+			master,
+			namespace,
+			*lease.Spec.HolderIdentity,
+			lease.Annotations["rr.seeker89.io/command"],
+			lease.Spec.AcquireTime.Format(time.RFC3339),
+			now.Sub(lease.Spec.RenewTime.Time).Round(time.Second),
+			l.Name,
+		)
+	default:
+		// the previous holder is gone, take over
+		lease.Annotations = annotations
+		lease.Spec = spec
+		_, err = cl.Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if errors.IsAlreadyExists(err) || errors.IsConflict(err) {
+		return nil, fmt.Errorf("%s in %s was just locked by someone else; got %s", master, namespace, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't take the lease %s in %s; got %s", l.Name, namespace, err)
+	}
+	go l.renew(ctx)
+	return l, nil
+}
+
+func (l *Lock) renew(ctx context.Context) {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.Duration / 3)
+	defer ticker.Stop()
+	cl := l.clientset.CoordinationV1().Leases(l.Namespace)
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		lease, err := cl.Get(ctx, l.Name, metav1.GetOptions{})
+		if err == nil && (lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.Holder) {
+			holder := ""
+			if lease.Spec.HolderIdentity != nil {
+				holder = *lease.Spec.HolderIdentity
+			}
+			l.err = fmt.Errorf("lost the lease %s in %s to %q", l.Name, l.Namespace, holder)
+			close(l.lost)
+			return
+		}
+		if err == nil {
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+			_, err = cl.Update(ctx, lease, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "can't renew the lease %s in %s; got %s\n", l.Name, l.Namespace, err)
+		// anyone else can take it from here
+		if time.Since(renewed) >= l.Duration {
+			l.err = fmt.Errorf("the lease %s in %s expired, not renewed since %s; last got %s", l.Name, l.Namespace, renewed.Format(time.RFC3339), err)
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// stops renewing, and deletes the lease if we still hold it
+func (l *Lock) Release(ctx context.Context) error {
+	close(l.stop)
+	<-l.stopped
+	cl := l.clientset.CoordinationV1().Leases(l.Namespace)
+	lease, err := cl.Get(ctx, l.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("can't release the lease %s in %s; got %s", l.Name, l.Namespace, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.Holder {
+		return nil
+	}
+	err = cl.Delete(ctx, l.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("can't release the lease %s in %s; got %s", l.Name, l.Namespace, err)
+	}
+	return nil
+}
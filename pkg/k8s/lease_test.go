@@ -0,0 +1,75 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAcquireLockRejectsShortDurations(t *testing.T) {
+	for _, d := range []time.Duration{-time.Second, 0, 500 * time.Millisecond} {
+		if _, err := AcquireLock(context.Background(), fake.NewClientset(), "mymaster", "redis", "alice", "test", d); err == nil {
+			t.Errorf("%s: expected an error", d)
+		}
+	}
+}
+
+func TestAcquireLockRoundsUpToSeconds(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	lock, err := AcquireLock(ctx, clientset, "mymaster", "redis", "alice", "test", 1500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(ctx)
+	lease, err := clientset.CoordinationV1().Leases("redis").Get(ctx, LockName("mymaster"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *lease.Spec.LeaseDurationSeconds != 2 {
+		t.Errorf("expected 2 seconds, got %d", *lease.Spec.LeaseDurationSeconds)
+	}
+	if _, err := AcquireLock(ctx, clientset, "mymaster", "redis", "bob", "test", time.Second); err == nil {
+		t.Errorf("expected the lock to be taken")
+	}
+}
+
+func TestLockLostToSomeoneElse(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	lock, err := AcquireLock(ctx, clientset, "mymaster", "redis", "alice", "test", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Err() != nil {
+		t.Fatalf("unexpected error %s", lock.Err())
+	}
+	cl := clientset.CoordinationV1().Leases("redis")
+	lease, err := cl.Get(ctx, LockName("mymaster"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := "bob"
+	lease.Spec.HolderIdentity = &bob
+	if _, err := cl.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the loss of the lock wasn't noticed")
+	}
+	if lock.Err() == nil {
+		t.Errorf("expected an error saying why")
+	}
+	// bob's lease stays
+	if err := lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Get(ctx, LockName("mymaster"), metav1.GetOptions{}); err != nil {
+		t.Errorf("expected bob's lease to stay; got %s", err)
+	}
+}
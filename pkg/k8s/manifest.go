@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"slices"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// a Secret with the values, for the variables that shouldn't be in the Job itself, like URLs with passwords
+func RRSecretManifest(name, namespace string, data map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       name,
+				"app.kubernetes.io/managed-by": ManagedBy,
+			},
+		},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: data,
+	}
+}
+
+// a Job running rr in the cluster with the args, or a CronJob when the schedule is set
+// the NAMESPACE comes from the pod itself, and the secretEnv variables from the keys of the same name in the secret
+func RRJobManifest(name, namespace, image, schedule string, args []string, env map[string]string, secret string, secretEnv []string) any {
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			"app.kubernetes.io/name":       name,
+			"app.kubernetes.io/managed-by": ManagedBy,
+		},
+	}
+	keys := []string{}
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vars := []corev1.EnvVar{
+		{
+			Name: "NAMESPACE",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+			},
+		},
+	}
+	for _, k := range keys {
+		vars = append(vars, corev1.EnvVar{Name: k, Value: env[k]})
+	}
+	secretEnv = slices.Sorted(slices.Values(secretEnv))
+	optional := true
+	for _, k := range secretEnv {
+		vars = append(vars, corev1.EnvVar{
+			Name: k,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  k,
+					// an existing secret might only have some of them
+					Optional: &optional,
+				},
+			},
+		})
+	}
+	// chaos experiments shouldn't be retried behind our backs
+	backoff := int32(0)
+	job := batchv1.JobSpec{
+		BackoffLimit: &backoff,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: meta.Labels},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: name,
+				RestartPolicy:      corev1.RestartPolicyNever,
+				Containers: []corev1.Container{
+					{
+						Name:  "rr",
+						Image: image,
+						Args:  args,
+						Env:   vars,
+					},
+				},
+			},
+		},
+	}
+	if schedule == "" {
+		return &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: meta,
+			Spec:       job,
+		}
+	}
+	return &batchv1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: meta,
+		Spec: batchv1.CronJobSpec{
+			Schedule: schedule,
+			// never run two experiments at the same time
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: job,
+			},
+		},
+	}
+}
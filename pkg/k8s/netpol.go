@@ -0,0 +1,305 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// label set by the StatefulSet controller on every pod
+	PodNameLabel = "statefulset.kubernetes.io/pod-name"
+	ManagedBy    = "rr"
+
+	// cut the pod off the sentinels, but let the clients in
+	PartitionSentinels = "sentinels"
+	// cut the pod off the clients, but let the sentinels in
+	PartitionClients = "clients"
+	// cut the pod off everything
+	PartitionAll = "all"
+)
+
+var PartitionModes = []string{PartitionSentinels, PartitionClients, PartitionAll}
+
+// on the policies the pod is excluded from, their podSelector from before, to restore it
+// even if rr dies before healing the partition
+const OriginalPodSelectorAnnotation = "rr/original-pod-selector"
+
+// a temporary NetworkPolicy isolating a single pod
+// NetworkPolicies only ever allow traffic, so any existing policy selecting the pod
+// needs to stop selecting it for the duration of the partition
+type Partition struct {
+	Pod       *corev1.Pod
+	Sentinels map[string]string
+	Mode      string
+
+	clientset kubernetes.Interface
+	excluded  []string
+}
+
+func NewPartition(clientset kubernetes.Interface, pod *corev1.Pod, sentinels map[string]string, mode string) (*Partition, error) {
+	if !slices.Contains(PartitionModes, mode) {
+		return nil, fmt.Errorf("unknown partition mode %s; expected one of %v", mode, PartitionModes)
+	}
+	if pod.Labels[PodNameLabel] == "" {
+		return nil, fmt.Errorf("pod %s in %s doesn't have the %s label", pod.Name, pod.Namespace, PodNameLabel)
+	}
+	// no labels would let everything in, the opposite of a partition
+	if mode != PartitionAll && len(sentinels) == 0 {
+		return nil, fmt.Errorf("no labels to tell the sentinels by; set them explicitly")
+	}
+	return &Partition{
+		Pod:       pod,
+		Sentinels: sentinels,
+		Mode:      mode,
+		clientset: clientset,
+	}, nil
+}
+
+func (p *Partition) Name() string {
+	return "rr-partition-" + p.Pod.Name
+}
+
+// selects the pods in all namespaces that aren't matched by the labels
+// a pod differing on any one of the labels is enough
+// no labels would be no peers, which NetworkPolicies take as everything
+func notMatching(lbls map[string]string) ([]networkingv1.NetworkPolicyPeer, error) {
+	if len(lbls) == 0 {
+		return nil, fmt.Errorf("no labels to select the peers by")
+	}
+	peers := []networkingv1.NetworkPolicyPeer{}
+	for k, v := range lbls {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{},
+			PodSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: k, Operator: metav1.LabelSelectorOpNotIn, Values: []string{v}},
+				},
+			},
+		})
+	}
+	return peers, nil
+}
+
+func (p *Partition) Policy() (*networkingv1.NetworkPolicy, error) {
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.Name(),
+			Namespace: p.Pod.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": ManagedBy,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					PodNameLabel: p.Pod.Labels[PodNameLabel],
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{},
+			Egress:  []networkingv1.NetworkPolicyEgressRule{},
+		},
+	}
+	var peers []networkingv1.NetworkPolicyPeer
+	switch p.Mode {
+	case PartitionSentinels:
+		var err error
+		if peers, err = notMatching(p.Sentinels); err != nil {
+			return nil, err
+		}
+	case PartitionClients:
+		// empty labels would select every pod
+		if len(p.Sentinels) == 0 {
+			return nil, fmt.Errorf("no labels to select the sentinels by")
+		}
+		peers = []networkingv1.NetworkPolicyPeer{
+			{PodSelector: &metav1.LabelSelector{MatchLabels: p.Sentinels}},
+		}
+	case PartitionAll:
+		return np, nil
+	}
+	// keep the DNS working
+	udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+	dns := intstr.FromInt32(53)
+	np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{From: peers})
+	np.Spec.Egress = append(np.Spec.Egress,
+		networkingv1.NetworkPolicyEgressRule{To: peers},
+		networkingv1.NetworkPolicyEgressRule{Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &udp, Port: &dns},
+			{Protocol: &tcp, Port: &dns},
+		}},
+	)
+	return np, nil
+}
+
+func (p *Partition) exclusion() metav1.LabelSelectorRequirement {
+	return metav1.LabelSelectorRequirement{
+		Key:      PodNameLabel,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{p.Pod.Labels[PodNameLabel]},
+	}
+}
+
+// excludes the pod from the existing policies, and creates the isolating one
+func (p *Partition) Apply(ctx context.Context, pq chan map[string]string) error {
+	policy, err := p.Policy()
+	if err != nil {
+		return err
+	}
+	cl := p.clientset.NetworkingV1().NetworkPolicies(p.Pod.Namespace)
+	list, err := cl.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("can't list network policies in %s; got %s", p.Pod.Namespace, err)
+	}
+	for _, np := range list.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+		if err != nil {
+			return fmt.Errorf("bad selector on network policy %s; got %s", np.Name, err)
+		}
+		if !selector.Matches(labels.Set(p.Pod.Labels)) {
+			continue
+		}
+		pq <- map[string]string{
+			"event":     "excluding pod from network policy",
+			"msg":       np.Name,
+			"name":      np.Name,
+			"namespace": np.Namespace,
+		}
+		// another partition may have recorded it already, with its own exclusion added since
+		if _, ok := np.Annotations[OriginalPodSelectorAnnotation]; !ok {
+			original, err := json.Marshal(np.Spec.PodSelector)
+			if err != nil {
+				return err
+			}
+			if np.Annotations == nil {
+				np.Annotations = map[string]string{}
+			}
+			np.Annotations[OriginalPodSelectorAnnotation] = string(original)
+		}
+		np.Spec.PodSelector.MatchExpressions = append(np.Spec.PodSelector.MatchExpressions, p.exclusion())
+		if _, err := cl.Update(ctx, &np, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("can't update network policy %s; got %s", np.Name, err)
+		}
+		p.excluded = append(p.excluded, np.Name)
+	}
+	pq <- map[string]string{
+		"event":     "creating network policy",
+		"msg":       p.Name(),
+		"name":      p.Name(),
+		"namespace": p.Pod.Namespace,
+		"mode":      p.Mode,
+	}
+	if _, err := cl.Create(ctx, policy, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("can't create network policy %s; got %s", p.Name(), err)
+	}
+	return nil
+}
+
+// removes the isolating policy, and restores the existing ones
+// it's safe to call after a partially failed Apply
+func (p *Partition) Heal(ctx context.Context, pq chan map[string]string) error {
+	cl := p.clientset.NetworkingV1().NetworkPolicies(p.Pod.Namespace)
+	pq <- map[string]string{
+		"event":     "deleting network policy",
+		"msg":       p.Name(),
+		"name":      p.Name(),
+		"namespace": p.Pod.Namespace,
+	}
+	var result error
+	err := cl.Delete(ctx, p.Name(), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		result = fmt.Errorf("can't delete network policy %s; got %s", p.Name(), err)
+	}
+	for _, name := range p.excluded {
+		np, err := cl.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			result = fmt.Errorf("can't get network policy %s; got %s", name, err)
+			continue
+		}
+		if err := p.restore(ctx, np, pq); err != nil {
+			result = err
+		}
+	}
+	p.excluded = nil
+	return result
+}
+
+func (p *Partition) excludes(np *networkingv1.NetworkPolicy) bool {
+	return slices.ContainsFunc(np.Spec.PodSelector.MatchExpressions, p.isExclusion)
+}
+
+func (p *Partition) isExclusion(r metav1.LabelSelectorRequirement) bool {
+	exclusion := p.exclusion()
+	return r.Key == exclusion.Key && r.Operator == exclusion.Operator && slices.Equal(r.Values, exclusion.Values)
+}
+
+// takes the pod's exclusion out of the policy, and once no other partition excludes a pod from it,
+// puts back the podSelector it had before, as recorded in the annotation
+func (p *Partition) restore(ctx context.Context, np *networkingv1.NetworkPolicy, pq chan map[string]string) error {
+	np.Spec.PodSelector.MatchExpressions = slices.DeleteFunc(np.Spec.PodSelector.MatchExpressions, p.isExclusion)
+	if recorded, ok := np.Annotations[OriginalPodSelectorAnnotation]; ok {
+		var original metav1.LabelSelector
+		if err := json.Unmarshal([]byte(recorded), &original); err != nil {
+			return fmt.Errorf("bad %s on network policy %s; got %s", OriginalPodSelectorAnnotation, np.Name, err)
+		}
+		// the other partitions add expressions of their own
+		if len(np.Spec.PodSelector.MatchExpressions) <= len(original.MatchExpressions) {
+			np.Spec.PodSelector = original
+			delete(np.Annotations, OriginalPodSelectorAnnotation)
+		}
+	}
+	if _, err := p.clientset.NetworkingV1().NetworkPolicies(np.Namespace).Update(ctx, np, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("can't restore network policy %s; got %s", np.Name, err)
+	}
+	pq <- map[string]string{
+		"event":     "restored network policy",
+		"msg":       np.Name,
+		"name":      np.Name,
+		"namespace": np.Namespace,
+	}
+	return nil
+}
+
+// heals what's left of an earlier partition of the same pod that rr didn't get to heal, like when it was killed:
+// deletes the isolating policy, and restores the ones the pod is still excluded from
+func (p *Partition) HealLeftovers(ctx context.Context, pq chan map[string]string) error {
+	cl := p.clientset.NetworkingV1().NetworkPolicies(p.Pod.Namespace)
+	list, err := cl.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("can't list network policies in %s; got %s", p.Pod.Namespace, err)
+	}
+	for _, np := range list.Items {
+		if np.Name == p.Name() && np.Labels["app.kubernetes.io/managed-by"] == ManagedBy {
+			pq <- map[string]string{
+				"event":     "deleting leftover network policy",
+				"msg":       np.Name,
+				"name":      np.Name,
+				"namespace": np.Namespace,
+			}
+			if err := cl.Delete(ctx, np.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("can't delete network policy %s; got %s", np.Name, err)
+			}
+			continue
+		}
+		if !p.excludes(&np) {
+			continue
+		}
+		if err := p.restore(ctx, &np, pq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
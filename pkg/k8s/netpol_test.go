@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func partitionPod() *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "redis-0",
+		Namespace: "redis",
+		Labels:    map[string]string{PodNameLabel: "redis-0", "app": "redis"},
+	}}
+}
+
+func userPolicy() *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-redis", Namespace: "redis"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "redis"}},
+		},
+	}
+}
+
+func drain(pq chan map[string]string) {
+	for range pq {
+	}
+}
+
+func TestNewPartitionRejectsEmptySelectors(t *testing.T) {
+	for _, mode := range []string{PartitionSentinels, PartitionClients} {
+		if _, err := NewPartition(fake.NewClientset(), partitionPod(), map[string]string{}, mode); err == nil {
+			t.Errorf("%s: expected an error for empty sentinel labels", mode)
+		}
+	}
+	if _, err := NewPartition(fake.NewClientset(), partitionPod(), nil, PartitionAll); err != nil {
+		t.Errorf("all: unexpected error %s", err)
+	}
+}
+
+func TestPolicyRejectsEmptySelectors(t *testing.T) {
+	for _, mode := range []string{PartitionSentinels, PartitionClients} {
+		p := &Partition{Pod: partitionPod(), Mode: mode}
+		if _, err := p.Policy(); err == nil {
+			t.Errorf("%s: expected an error for empty sentinel labels", mode)
+		}
+	}
+}
+
+func TestPartitionApplyHeal(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(userPolicy())
+	pq := make(chan map[string]string)
+	go drain(pq)
+	defer close(pq)
+	p, err := NewPartition(clientset, partitionPod(), map[string]string{"app": "redis"}, PartitionSentinels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(ctx, pq); err != nil {
+		t.Fatal(err)
+	}
+	cl := clientset.NetworkingV1().NetworkPolicies("redis")
+	np, err := cl.Get(ctx, "allow-redis", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.excludes(np) || np.Annotations[OriginalPodSelectorAnnotation] == "" {
+		t.Fatalf("expected the pod excluded, with the original recorded; got %+v", np)
+	}
+	if _, err := cl.Get(ctx, p.Name(), metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the isolating policy; got %s", err)
+	}
+	if err := p.Heal(ctx, pq); err != nil {
+		t.Fatal(err)
+	}
+	np, err = cl.Get(ctx, "allow-redis", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(np.Spec.PodSelector, userPolicy().Spec.PodSelector) || len(np.Annotations) != 0 {
+		t.Errorf("expected the policy restored; got %+v", np)
+	}
+	if _, err := cl.Get(ctx, p.Name(), metav1.GetOptions{}); err == nil {
+		t.Errorf("expected the isolating policy gone")
+	}
+}
+
+func TestPartitionHealLeftovers(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(userPolicy())
+	pq := make(chan map[string]string)
+	go drain(pq)
+	defer close(pq)
+	sentinels := map[string]string{"app": "redis"}
+	// the run that got killed before healing
+	killed, _ := NewPartition(clientset, partitionPod(), sentinels, PartitionClients)
+	if err := killed.Apply(ctx, pq); err != nil {
+		t.Fatal(err)
+	}
+	p, _ := NewPartition(clientset, partitionPod(), sentinels, PartitionClients)
+	if err := p.HealLeftovers(ctx, pq); err != nil {
+		t.Fatal(err)
+	}
+	list, err := clientset.NetworkingV1().NetworkPolicies("redis").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected only the user's policy left; got %d", len(list.Items))
+	}
+	if !reflect.DeepEqual(list.Items[0].Spec.PodSelector, userPolicy().Spec.PodSelector) {
+		t.Errorf("expected the policy restored; got %+v", list.Items[0].Spec.PodSelector)
+	}
+}
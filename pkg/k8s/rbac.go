@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// a single verb on a single resource, in the namespace
+type Permission struct {
+	Group    string
+	Resource string
+	Verb     string
+}
+
+func (p Permission) String() string {
+	if p.Group == "" {
+		return fmt.Sprintf("%s %s", p.Verb, p.Resource)
+	}
+	return fmt.Sprintf("%s %s.%s", p.Verb, p.Resource, p.Group)
+}
+
+func Permissions(group, resource string, verbs ...string) []Permission {
+	res := []Permission{}
+	for _, v := range verbs {
+		res = append(res, Permission{Group: group, Resource: resource, Verb: v})
+	}
+	return res
+}
+
+// asks the API server which of the permissions the current user doesn't have
+func MissingPermissions(ctx context.Context, clientset kubernetes.Interface, namespace string, perms []Permission) ([]Permission, error) {
+	missing := []Permission{}
+	for _, p := range perms {
+		// subresources, like pods/log, are checked separately
+		resource, subresource, _ := strings.Cut(p.Resource, "/")
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   namespace,
+					Group:       p.Group,
+					Resource:    resource,
+					Subresource: subresource,
+					Verb:        p.Verb,
+				},
+			},
+		}
+		res, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("can't check if allowed to %s in %s; got %s", p, namespace, err)
+		}
+		if !res.Status.Allowed {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+// groups the permissions into as few rules as possible
+func PolicyRules(perms []Permission) []rbacv1.PolicyRule {
+	type key struct{ group, resource string }
+	verbs := map[key][]string{}
+	keys := []key{}
+	for _, p := range perms {
+		k := key{p.Group, p.Resource}
+		if _, ok := verbs[k]; !ok {
+			keys = append(keys, k)
+		}
+		if !slices.Contains(verbs[k], p.Verb) {
+			verbs[k] = append(verbs[k], p.Verb)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].resource < keys[j].resource
+	})
+	rules := []rbacv1.PolicyRule{}
+	for _, k := range keys {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{k.group},
+			Resources: []string{k.resource},
+			Verbs:     verbs[k],
+		})
+	}
+	return rules
+}
+
+// the ServiceAccount, Role and RoleBinding granting the permissions in the namespace
+// just the ServiceAccount, if there aren't any permissions to grant
+func RBACManifests(name, namespace string, perms []Permission) []any {
+	labels := map[string]string{
+		"app.kubernetes.io/name":       name,
+		"app.kubernetes.io/managed-by": ManagedBy,
+	}
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    labels,
+	}
+	sa := &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: meta,
+	}
+	if len(perms) == 0 {
+		return []any{sa}
+	}
+	return []any{
+		sa,
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: meta,
+			Rules:      PolicyRules(perms),
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: meta,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "Role",
+				Name:     name,
+			},
+			Subjects: []rbacv1.Subject{
+				{Kind: "ServiceAccount", Name: name, Namespace: namespace},
+			},
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	twatch "k8s.io/client-go/tools/watch"
+)
+
+// the same annotation `kubectl rollout restart` uses
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// finds the StatefulSet owning the pod
+func GetStatefulSetForPod(ctx context.Context, clientset kubernetes.Interface, name, namespace string) (*appsv1.StatefulSet, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't get the pod %s in %s; got %s", name, namespace, err)
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "StatefulSet" {
+			return clientset.AppsV1().StatefulSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		}
+	}
+	return nil, fmt.Errorf("pod %s in %s isn't owned by a StatefulSet", name, namespace)
+}
+
+// triggers a rollout of the StatefulSet by bumping an annotation on the pod template
+func RestartStatefulSet(ctx context.Context, clientset kubernetes.Interface, name, namespace string) (*appsv1.StatefulSet, error) {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{
+						RestartedAtAnnotation: time.Now().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+}
+
+func isRolledOut(sts *appsv1.StatefulSet, generation int64) bool {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	return sts.Status.ObservedGeneration >= generation &&
+		sts.Status.UpdatedReplicas == replicas &&
+		sts.Status.ReadyReplicas == replicas &&
+		sts.Status.CurrentRevision == sts.Status.UpdateRevision
+}
+
+type podTiming struct {
+	uid         types.UID
+	terminating time.Time
+	created     time.Time
+}
+
+// follows the pods of the StatefulSet being rolled out, and reports when each of them restarts
+// only reports errors on done, runs until the context is cancelled
+func WatchRollout(ctx context.Context, clientset kubernetes.Interface, sts *appsv1.StatefulSet, done chan error, pq chan map[string]string) {
+	cl := clientset.CoreV1().Pods(sts.Namespace)
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		done <- fmt.Errorf("bad selector on %s; got %s", sts.Name, err)
+		return
+	}
+	list, err := cl.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		done <- fmt.Errorf("can't list pods for %s; got %s", sts.Name, err)
+		return
+	}
+	timings := map[string]*podTiming{}
+	for _, pod := range list.Items {
+		timings[pod.Name] = &podTiming{uid: pod.UID}
+	}
+	wf := func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+		options.LabelSelector = selector.String()
+		return cl.Watch(ctx, options)
+	}
+	wr, err := twatch.NewRetryWatcherWithContext(ctx, list.ResourceVersion, &cache.ListWatch{WatchFuncWithContext: wf})
+	if err != nil {
+		done <- fmt.Errorf("can't create retry watcher; got %s", err)
+		return
+	}
+	defer wr.Stop()
+	for event := range wr.ResultChan() {
+		pod, ok := event.Object.(*corev1.Pod)
+		if !ok {
+			continue
+		}
+		t, ok := timings[pod.Name]
+		if !ok {
+			t = &podTiming{uid: pod.UID}
+			timings[pod.Name] = t
+		}
+		switch {
+		case event.Type == watch.Deleted:
+			pq <- map[string]string{
+				"event":     "pod deleted",
+				"msg":       pod.Name,
+				"name":      pod.Name,
+				"namespace": pod.Namespace,
+			}
+		case pod.UID == t.uid && pod.DeletionTimestamp != nil && t.terminating.IsZero():
+			t.terminating = time.Now()
+			pq <- map[string]string{
+				"event":     "pod terminating",
+				"msg":       pod.Name,
+				"name":      pod.Name,
+				"namespace": pod.Namespace,
+			}
+		case pod.UID != t.uid:
+			t.uid = pod.UID
+			t.created = time.Now()
+			pq <- map[string]string{
+				"event":     "pod created",
+				"msg":       pod.Name,
+				"name":      pod.Name,
+				"namespace": pod.Namespace,
+			}
+			fallthrough
+		case !t.created.IsZero() && isPodReady(pod):
+			if !isPodReady(pod) {
+				continue
+			}
+			evt := map[string]string{
+				"event":     "pod restarted",
+				"msg":       pod.Name,
+				"name":      pod.Name,
+				"namespace": pod.Namespace,
+				"starting":  time.Since(t.created).String(),
+			}
+			if !t.terminating.IsZero() {
+				evt["down"] = time.Since(t.terminating).String()
+			}
+			pq <- evt
+			// only report each pod once
+			t.created = time.Time{}
+			t.terminating = time.Time{}
+		}
+	}
+}
+
+// polls the StatefulSet until it reports all the replicas updated and ready
+func WaitForRollout(ctx context.Context, clientset kubernetes.Interface, sts *appsv1.StatefulSet, interval time.Duration, done chan error, pq chan map[string]string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := clientset.AppsV1().StatefulSets(sts.Namespace).Get(ctx, sts.Name, metav1.GetOptions{})
+		if err != nil {
+			done <- fmt.Errorf("can't get %s; got %s", sts.Name, err)
+			return
+		}
+		if !isRolledOut(current, sts.Generation) {
+			continue
+		}
+		pq <- map[string]string{
+			"event":     "rollout finished",
+			"msg":       sts.Name,
+			"name":      sts.Name,
+			"namespace": sts.Namespace,
+			"revision":  current.Status.UpdateRevision,
+		}
+		done <- nil
+		return
+	}
+}
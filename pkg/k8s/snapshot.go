@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/bundle"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// saves the pods & StatefulSet of the redis deployment the pod is part of, the PodDisruptionBudgets covering them,
+// and all the Kubernetes Events in the namespace
+// when the pod isn't owned by a StatefulSet, saves all the pods & StatefulSets in the namespace instead
+// whatever can't be read is recorded as an error in the index, rather than failing the snapshot
+func SnapshotObjects(ctx context.Context, clientset kubernetes.Interface, name, namespace string, w *bundle.Writer) error {
+	selector := labels.Everything()
+	sts, err := GetStatefulSetForPod(ctx, clientset, name, namespace)
+	if err != nil {
+		w.AddError("kubernetes/statefulsets.json", err)
+		list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			w.AddError("kubernetes/statefulsets.json", err)
+		} else {
+			for i := range list.Items {
+				list.Items[i].ManagedFields = nil
+			}
+			if err := w.AddJSON("kubernetes/statefulsets.json", list.Items, fmt.Sprintf("all the StatefulSets in %s", namespace)); err != nil {
+				return err
+			}
+		}
+	} else {
+		selector, err = metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+		if err != nil {
+			return fmt.Errorf("bad selector on %s; got %s", sts.Name, err)
+		}
+		sts.ManagedFields = nil
+		if err := w.AddJSON("kubernetes/statefulsets.json", sts, fmt.Sprintf("the StatefulSet %s owning %s", sts.Name, name)); err != nil {
+			return err
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		w.AddError("kubernetes/pods.json", err)
+	} else {
+		for i := range pods.Items {
+			pods.Items[i].ManagedFields = nil
+		}
+		if err := w.AddJSON("kubernetes/pods.json", pods.Items, fmt.Sprintf("the pods in %s matching %s", namespace, selector)); err != nil {
+			return err
+		}
+	}
+
+	pdbs, err := clientset.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		w.AddError("kubernetes/poddisruptionbudgets.json", err)
+	} else {
+		items := pdbs.Items[:0]
+		for _, pdb := range pdbs.Items {
+			s, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil {
+				continue
+			}
+			// keep the ones covering any of the pods
+			covers := sts == nil
+			if pods != nil {
+				for _, pod := range pods.Items {
+					covers = covers || s.Matches(labels.Set(pod.Labels))
+				}
+			}
+			if covers {
+				pdb.ManagedFields = nil
+				items = append(items, pdb)
+			}
+		}
+		if err := w.AddJSON("kubernetes/poddisruptionbudgets.json", items, "the PodDisruptionBudgets covering the pods"); err != nil {
+			return err
+		}
+	}
+
+	// all of them, we don't know when the trouble started
+	// the collector records the error in the index itself
+	NewCollector(clientset, namespace, time.Time{}, w).Events(ctx, time.Now())
+	return nil
+}
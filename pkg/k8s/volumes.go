@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// deletes all the PVCs mounted by the pod, and returns their names & UIDs
+// the PVCs will stay around until the pod is gone
+func DeletePodVolumes(ctx context.Context, clientset kubernetes.Interface, name, namespace string, pq chan map[string]string) (map[string]types.UID, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't get the pod %s in %s; got %s", name, namespace, err)
+	}
+	cl := clientset.CoreV1().PersistentVolumeClaims(namespace)
+	claims := map[string]types.UID{}
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		claim := v.PersistentVolumeClaim.ClaimName
+		pvc, err := cl.Get(ctx, claim, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("can't get the pvc %s in %s; got %s", claim, namespace, err)
+		}
+		pq <- map[string]string{
+			"event":     "deleting pvc",
+			"msg":       claim,
+			"name":      claim,
+			"namespace": namespace,
+		}
+		if err := cl.Delete(ctx, claim, metav1.DeleteOptions{}); err != nil {
+			return nil, fmt.Errorf("error deleting pvc %s in %s; got %s", claim, namespace, err)
+		}
+		claims[claim] = pvc.UID
+	}
+	if len(claims) == 0 {
+		return nil, fmt.Errorf("pod %s in %s doesn't use any pvc", name, namespace)
+	}
+	return claims, nil
+}
+
+// polls until all the claims are recreated (different UID) and bound
+// if the pod comes back while an old claim is still terminating, it will never start
+// so it gets deleted again, for the StatefulSet to recreate it with a fresh claim
+func WaitForFreshVolumes(ctx context.Context, clientset kubernetes.Interface, name, namespace string, claims map[string]types.UID, interval time.Duration, done chan error, pq chan map[string]string) {
+	cl := clientset.CoreV1().PersistentVolumeClaims(namespace)
+	pods := clientset.CoreV1().Pods(namespace)
+	fresh := map[string]bool{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for len(fresh) < len(claims) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for claim, uid := range claims {
+			if fresh[claim] {
+				continue
+			}
+			pvc, err := cl.Get(ctx, claim, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				done <- fmt.Errorf("can't get the pvc %s in %s; got %s", claim, namespace, err)
+				return
+			}
+			if pvc.UID == uid {
+				pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+				if err != nil || pod.DeletionTimestamp != nil {
+					continue
+				}
+				pq <- map[string]string{
+					"event":     "deleting pod stuck on old pvc",
+					"msg":       name,
+					"name":      name,
+					"pvc":       claim,
+					"namespace": namespace,
+				}
+				if err := pods.Delete(ctx, name, *metav1.NewDeleteOptions(0)); err != nil && !errors.IsNotFound(err) {
+					done <- fmt.Errorf("error deleting pod; got %s", err)
+					return
+				}
+				continue
+			}
+			if pvc.Status.Phase != corev1.ClaimBound {
+				continue
+			}
+			fresh[claim] = true
+			pq <- map[string]string{
+				"event":     "pvc recreated",
+				"msg":       claim,
+				"name":      claim,
+				"volume":    pvc.Spec.VolumeName,
+				"namespace": namespace,
+			}
+		}
+	}
+	done <- nil
+}
@@ -0,0 +1,113 @@
+package load
+
+import (
+	"math/bits"
+	"time"
+)
+
+// values below 2^subBits get a bucket each, and every power of two above is split in 2^subBits buckets
+// which keeps the error under 1% for any value, HDR-style, in a fixed amount of memory
+const (
+	subBits    = 7
+	subBuckets = 1 << subBits
+	buckets    = (64-subBits-1)*subBuckets + subBuckets
+)
+
+// latencies recorded with a bounded relative error, to be merged and queried for percentiles
+type Histogram struct {
+	counts [buckets]int64
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func bucketOf(v int64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBits - 1
+	return shift<<subBits + int(v>>shift)
+}
+
+// the highest value falling into the bucket
+func bucketValue(b int) int64 {
+	if b < subBuckets {
+		return int64(b)
+	}
+	shift := b>>subBits - 1
+	top := int64(b - shift<<subBits)
+	return (top+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucketOf(int64(d))]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	h.max = max(h.max, d)
+	h.count++
+	h.sum += d
+}
+
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	h.max = max(h.max, o.max)
+	h.count += o.count
+	h.sum += o.sum
+}
+
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+func (h *Histogram) Min() time.Duration {
+	return h.min
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// returns the given percentile (0-100), never more than the max recorded
+func (h *Histogram) Percentile(pct float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(float64(h.count)*pct/100 + 0.5)
+	rank = min(max(rank, 1), h.count)
+	var seen int64
+	for b, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(time.Duration(bucketValue(b)), h.max)
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,71 @@
+package load
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	values := []int64{0, 1, 127, 128, 129, 255, 256, 1000, 123456, int64(time.Second), int64(time.Hour), math.MaxInt64 / 2, math.MaxInt64}
+	prev := -1
+	for _, v := range values {
+		b := bucketOf(v)
+		if b < 0 || b >= buckets {
+			t.Fatalf("%d: bucket %d out of range", v, b)
+		}
+		if b < prev {
+			t.Errorf("%d: bucket %d before the one of a smaller value, %d", v, b, prev)
+		}
+		prev = b
+		top := bucketValue(b)
+		if top < v {
+			t.Errorf("%d: bucket %d tops at %d", v, b, top)
+		}
+		// the values below the sub-buckets are exact, the others within 1%
+		if v < subBuckets && top != v {
+			t.Errorf("%d: expected exact, got %d", v, top)
+		}
+		if v > 0 && float64(top-v)/float64(v) > 0.01 {
+			t.Errorf("%d: %d is more than 1%% off", v, top)
+		}
+		// and the next bucket starts right after
+		if b+1 < buckets && bucketOf(top+1) != b+1 {
+			t.Errorf("%d: %d falls into bucket %d, expected %d", v, top+1, bucketOf(top+1), b+1)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	if h.Percentile(99) != 0 {
+		t.Errorf("expected 0 for an empty histogram")
+	}
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	tests := []struct {
+		pct  float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 500 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		got := h.Percentile(tt.pct)
+		if got < tt.want || float64(got-tt.want)/float64(tt.want) > 0.01 {
+			t.Errorf("p%v: expected about %s, got %s", tt.pct, tt.want, got)
+		}
+	}
+	if h.Min() != time.Millisecond || h.Max() != time.Second || h.Count() != 1000 {
+		t.Errorf("unexpected min %s, max %s or count %d", h.Min(), h.Max(), h.Count())
+	}
+	o := NewHistogram()
+	o.Record(2 * time.Second)
+	h.Merge(o)
+	if h.Max() != 2*time.Second || h.Count() != 1001 || h.Percentile(100) != 2*time.Second {
+		t.Errorf("unexpected max %s or count %d after merging", h.Max(), h.Count())
+	}
+}
@@ -0,0 +1,330 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/probe"
+)
+
+// the operations a workload can mix
+const (
+	OpGet   = "get"
+	OpSet   = "set"
+	OpIncr  = "incr"
+	OpHSet  = "hset"
+	OpLPush = "lpush"
+	// GETs and SETs in a single round trip
+	OpPipeline = "pipeline"
+	// INCR and SET in a MULTI/EXEC transaction
+	OpMulti = "multi"
+)
+
+var Ops = []string{OpGet, OpSet, OpIncr, OpHSet, OpLPush, OpPipeline, OpMulti}
+
+// how many items the lists are trimmed to, not to grow forever
+const listLength = 100
+
+// how often each operation is picked, relative to the others
+type Mix map[string]int
+
+// parses items like "get=80"
+func ParseMix(items []string) (Mix, error) {
+	mix := Mix{}
+	for _, item := range items {
+		op, weight, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad mix %q; expected op=weight", item)
+		}
+		if !slices.Contains(Ops, op) {
+			return nil, fmt.Errorf("unknown op %s; expected one of %s", op, strings.Join(Ops, ", "))
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bad weight for %s: %q", op, weight)
+		}
+		mix[op] += w
+	}
+	total := 0
+	for _, w := range mix {
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("the mix needs at least one op with a positive weight")
+	}
+	return mix, nil
+}
+
+// the ops in the mix, in a stable order
+func (m Mix) Ops() []string {
+	ops := []string{}
+	for _, op := range Ops {
+		if m[op] > 0 {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func (m Mix) pick(r *rand.Rand) string {
+	total := 0
+	for _, w := range m {
+		total += w
+	}
+	n := r.Intn(total)
+	for _, op := range m.Ops() {
+		n -= m[op]
+		if n < 0 {
+			return op
+		}
+	}
+	return ""
+}
+
+// what happened to the operations of one kind
+type Stats struct {
+	Op     string
+	Ops    int64
+	Errors int64
+	// by probe.ErrorType
+	ErrorTypes map[string]int64
+	Latency    *Histogram
+}
+
+func newStats(op string) *Stats {
+	return &Stats{
+		Op:         op,
+		ErrorTypes: map[string]int64{},
+		Latency:    NewHistogram(),
+	}
+}
+
+func (s *Stats) Merge(o *Stats) {
+	s.Ops += o.Ops
+	s.Errors += o.Errors
+	for t, n := range o.ErrorTypes {
+		s.ErrorTypes[t] += n
+	}
+	s.Latency.Merge(o.Latency)
+}
+
+// drives a mix of operations against the client, from a number of concurrent clients
+type Workload struct {
+	Client  redis.UniversalClient
+	Mix     Mix
+	Clients int
+	// operations per second over all the clients, 0 for as many as possible
+	Rate int
+	// how many keys of each type to spread the operations over
+	Keys         int
+	KeyPrefix    string
+	ValueSize    int
+	PipelineSize int
+	// optionally, where to record every operation, without the values
+	History *history.Recorder
+
+	mu      sync.Mutex
+	current map[string]*Stats
+	total   map[string]*Stats
+}
+
+// runs all the clients until the context is done
+func (w *Workload) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range w.Clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.runClient(ctx, i)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Workload) runClient(ctx context.Context, client int) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(client)))
+	value := make([]byte, w.ValueSize)
+	for i := range value {
+		value[i] = 'a' + byte(r.Intn(26))
+	}
+	var interval time.Duration
+	if w.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(w.Clients) / float64(w.Rate))
+	}
+	process := fmt.Sprintf("load_%d", client)
+	next := time.Now()
+	for ctx.Err() == nil {
+		start := time.Now()
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			// measure from when the op was due rather than sent, so that a stall
+			// shows up in the latencies of everything it held back
+			start = next
+			next = next.Add(interval)
+		}
+		op := w.Mix.pick(r)
+		key := w.key(r, opKinds[op])
+		// not as reads and writes, since the values aren't recorded
+		// but the incrs are, by how much they add and what they return, for the counter model
+		var by *string
+		if op == OpIncr {
+			by = history.Value(1)
+		}
+		invoke := w.History.Invoke(process, op, key, by)
+		result, err := w.do(ctx, r, op, key, value)
+		latency := time.Since(start)
+		if ctx.Err() != nil {
+			return
+		}
+		w.History.Complete(invoke, result, err)
+		w.record(op, latency, err)
+	}
+}
+
+func (w *Workload) key(r *rand.Rand, kind string) string {
+	if kind == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s%s:%d", w.KeyPrefix, kind, r.Intn(w.Keys))
+}
+
+// the kind of key each operation works on
+var opKinds = map[string]string{
+	OpGet:   "string",
+	OpSet:   "string",
+	OpIncr:  "counter",
+	OpHSet:  "hash",
+	OpLPush: "list",
+}
+
+// does the op on the key, if it's about a single one, returning what an incr returned
+func (w *Workload) do(ctx context.Context, r *rand.Rand, op, key string, value []byte) (*string, error) {
+	switch op {
+	case OpGet:
+		err := w.Client.Get(ctx, key).Err()
+		if err == redis.Nil {
+			err = nil
+		}
+		return nil, err
+	case OpSet:
+		return nil, w.Client.Set(ctx, key, value, 0).Err()
+	case OpIncr:
+		n, err := w.Client.Incr(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		return history.Value(n), nil
+	case OpHSet:
+		return nil, w.Client.HSet(ctx, key, fmt.Sprintf("field:%d", r.Intn(listLength)), value).Err()
+	case OpLPush:
+		_, err := w.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.LPush(ctx, key, value)
+			p.LTrim(ctx, key, 0, listLength-1)
+			return nil
+		})
+		return nil, err
+	case OpPipeline:
+		cmds, err := w.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			for i := range w.PipelineSize {
+				if i%2 == 0 {
+					p.Set(ctx, w.key(r, "string"), value, 0)
+				} else {
+					p.Get(ctx, w.key(r, "string"))
+				}
+			}
+			return nil
+		})
+		// Pipelined returns the first error, which can be a GET of a missing key hiding a real one after it
+		for _, cmd := range cmds {
+			if err := cmd.Err(); err != nil && err != redis.Nil {
+				return nil, err
+			}
+		}
+		if err == redis.Nil {
+			err = nil
+		}
+		return nil, err
+	case OpMulti:
+		// counters of its own, as the history has the incrs of the others, and not these
+		_, err := w.Client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Incr(ctx, w.key(r, "tx-counter"))
+			p.Set(ctx, w.key(r, "string"), value, 0)
+			return nil
+		})
+		return nil, err
+	}
+	return nil, fmt.Errorf("unknown op %s", op)
+}
+
+func (w *Workload) record(op string, latency time.Duration, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current == nil {
+		w.current = map[string]*Stats{}
+	}
+	s, ok := w.current[op]
+	if !ok {
+		s = newStats(op)
+		w.current[op] = s
+	}
+	s.Ops++
+	if err != nil {
+		s.Errors++
+		s.ErrorTypes[probe.ErrorType(err)]++
+		return
+	}
+	s.Latency.Record(latency)
+}
+
+// returns the stats since the previous tick, and adds them to the totals
+func (w *Workload) Tick() map[string]*Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	current := w.current
+	w.current = map[string]*Stats{}
+	if w.total == nil {
+		w.total = map[string]*Stats{}
+	}
+	for op, s := range current {
+		if _, ok := w.total[op]; !ok {
+			w.total[op] = newStats(op)
+		}
+		w.total[op].Merge(s)
+	}
+	return current
+}
+
+// returns the stats of the whole run, up to the last tick
+func (w *Workload) Totals() map[string]*Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	total := map[string]*Stats{}
+	for op, s := range w.total {
+		total[op] = newStats(op)
+		total[op].Merge(s)
+	}
+	return total
+}
+
+// all the ops together
+func Overall(stats map[string]*Stats) *Stats {
+	all := newStats("all")
+	for _, s := range stats {
+		all.Merge(s)
+	}
+	return all
+}
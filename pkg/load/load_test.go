@@ -0,0 +1,43 @@
+package load
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		items []string
+		want  Mix
+	}{
+		{[]string{"get=80", "set=20"}, Mix{OpGet: 80, OpSet: 20}},
+		{[]string{"get=1", "get=2", "incr=0"}, Mix{OpGet: 3, OpIncr: 0}},
+		{[]string{"pipeline=1", "multi=1"}, Mix{OpPipeline: 1, OpMulti: 1}},
+		{[]string{"get"}, nil},
+		{[]string{"del=1"}, nil},
+		{[]string{"get=-1", "set=2"}, nil},
+		{[]string{"get=x"}, nil},
+		{[]string{"get=0"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseMix(tt.items)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.items, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tt.items, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.items, tt.want, got)
+		}
+	}
+	mix, _ := ParseMix([]string{"set=1", "incr=0", "get=1"})
+	if ops := mix.Ops(); !reflect.DeepEqual(ops, []string{OpGet, OpSet}) {
+		t.Errorf("expected get and set, in order; got %v", ops)
+	}
+}
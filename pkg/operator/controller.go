@@ -0,0 +1,249 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// runs the experiments declared as RedisChaosExperiments, and writes the results into their status
+// it polls rather than watches, as the experiments run minutes apart at best
+type Controller struct {
+	Namespace    string
+	Resync       time.Duration
+	LockDuration time.Duration
+
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// an empty namespace means all of them
+func NewController(clientset kubernetes.Interface, dyn dynamic.Interface, namespace string, resync, lockDuration time.Duration) *Controller {
+	return &Controller{
+		Namespace:    namespace,
+		Resync:       resync,
+		LockDuration: lockDuration,
+		clientset:    clientset,
+		dynamic:      dyn,
+		running:      map[string]bool{},
+	}
+}
+
+// reconciles all the experiments every resync, until the context is cancelled
+func (c *Controller) Run(ctx context.Context, pq chan map[string]string) error {
+	ticker := time.NewTicker(c.Resync)
+	defer ticker.Stop()
+	for {
+		list, err := c.dynamic.Resource(GVR).Namespace(c.Namespace).List(ctx, metav1.ListOptions{})
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("%s isn't installed in the cluster; try rr operator crd | kubectl apply -f -", GVR.GroupResource())
+		}
+		if err != nil {
+			pq <- map[string]string{
+				"event": "list failed",
+				"msg":   err.Error(),
+			}
+		} else {
+			for i := range list.Items {
+				if err := c.Reconcile(ctx, &list.Items[i], time.Now(), pq); err != nil {
+					pq <- map[string]string{
+						"event":      "reconcile failed",
+						"experiment": list.Items[i].GetNamespace() + "/" + list.Items[i].GetName(),
+						"msg":        err.Error(),
+					}
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) isRunning(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running[key]
+}
+
+func (c *Controller) setRunning(key string, running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if running {
+		c.running[key] = true
+	} else {
+		delete(c.running, key)
+	}
+}
+
+// when the experiment should run next, and whether that's now
+func (c *Controller) nextRun(exp *Experiment, now time.Time) (time.Time, bool) {
+	if exp.Spec.Suspend {
+		return time.Time{}, false
+	}
+	if exp.Spec.Schedule == "" {
+		return now, exp.Status.LastRun == nil
+	}
+	schedule, err := ParseSchedule(exp.Spec.Schedule)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// missed runs aren't caught up on, only the last one
+	last := exp.CreationTimestamp.Time
+	if exp.Status.LastRun != nil {
+		if t, err := time.Parse(time.RFC3339, exp.Status.LastRun.StartTime); err == nil {
+			last = t
+		}
+	}
+	next := schedule.Next(last)
+	return next, !next.IsZero() && !now.Before(next)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// brings the experiment's status up to date, and starts a run when it's due
+func (c *Controller) Reconcile(ctx context.Context, u *unstructured.Unstructured, now time.Time, pq chan map[string]string) error {
+	exp, err := FromUnstructured(u)
+	if err != nil {
+		return err
+	}
+	key := exp.Key()
+	if c.isRunning(key) {
+		return nil
+	}
+	if err := exp.Validate(); err != nil {
+		if exp.Status.Phase == PhaseInvalid && exp.Status.Message == err.Error() {
+			return nil
+		}
+		return c.updateStatus(ctx, exp, func(s *ExperimentStatus) {
+			s.Phase = PhaseInvalid
+			s.Message = err.Error()
+			s.NextRunTime = ""
+		})
+	}
+	// we were restarted in the middle of a run
+	if exp.Status.Phase == PhaseRunning {
+		return c.updateStatus(ctx, exp, func(s *ExperimentStatus) {
+			s.Phase = PhaseFailed
+			s.Message = "interrupted, the operator stopped during the run"
+			s.Runs++
+		})
+	}
+	next, due := c.nextRun(exp, now)
+	if !due {
+		phase := exp.Status.Phase
+		if phase == "" || phase == PhaseInvalid {
+			phase = PhaseScheduled
+		}
+		nextRunTime := formatTime(next)
+		if exp.Spec.Schedule == "" {
+			nextRunTime = ""
+		}
+		if phase == exp.Status.Phase && nextRunTime == exp.Status.NextRunTime && exp.Status.ObservedGeneration == exp.Generation {
+			return nil
+		}
+		return c.updateStatus(ctx, exp, func(s *ExperimentStatus) {
+			if s.Phase != phase {
+				s.Message = ""
+			}
+			s.Phase = phase
+			s.NextRunTime = nextRunTime
+		})
+	}
+
+	// run it in the background, so that one experiment doesn't hold up the others
+	c.setRunning(key, true)
+	err = c.updateStatus(ctx, exp, func(s *ExperimentStatus) {
+		s.Phase = PhaseRunning
+		s.Message = ""
+		s.NextRunTime = ""
+		s.LastRun = &RunStatus{StartTime: formatTime(now)}
+	})
+	if err != nil {
+		c.setRunning(key, false)
+		return err
+	}
+	go func() {
+		defer c.setRunning(key, false)
+		pq <- map[string]string{
+			"event":      "experiment started",
+			"experiment": key,
+			"msg":        exp.Spec.Fault,
+		}
+		res := c.run(ctx, exp, pq)
+		pq <- map[string]string{
+			"event":      "experiment finished",
+			"experiment": key,
+			"msg":        res.Result,
+			"old_master": res.OldMaster,
+			"new_master": res.NewMaster,
+			"duration":   res.Duration,
+			"error":      res.Message,
+		}
+		err := c.updateStatus(ctx, exp, func(s *ExperimentStatus) {
+			s.Phase = res.Result
+			s.Message = res.Message
+			s.Runs++
+			s.LastRun = res
+		})
+		if err != nil {
+			pq <- map[string]string{
+				"event":      "status not updated",
+				"experiment": key,
+				"msg":        err.Error(),
+			}
+		}
+	}()
+	return nil
+}
+
+// applies the change to the latest version of the status, retrying on conflicts
+// the next run time is derived from the result, so it's always updated along
+func (c *Controller) updateStatus(ctx context.Context, exp *Experiment, change func(*ExperimentStatus)) error {
+	cl := c.dynamic.Resource(GVR).Namespace(exp.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		u, err := cl.Get(ctx, exp.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		latest, err := FromUnstructured(u)
+		if err != nil {
+			return err
+		}
+		change(&latest.Status)
+		latest.Status.ObservedGeneration = u.GetGeneration()
+		if latest.Status.Phase != PhaseRunning && latest.Status.Phase != PhaseInvalid && latest.Spec.Schedule != "" {
+			if next, _ := c.nextRun(latest, time.Now()); !next.IsZero() {
+				latest.Status.NextRunTime = formatTime(next)
+			}
+		}
+		status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&latest.Status)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(u.Object, status, "status"); err != nil {
+			return err
+		}
+		_, err = cl.UpdateStatus(ctx, u, metav1.UpdateOptions{})
+		return err
+	})
+}
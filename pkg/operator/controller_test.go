@@ -0,0 +1,210 @@
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var created = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+func experiment(spec ExperimentSpec, status ExperimentStatus) *unstructured.Unstructured {
+	exp := &Experiment{
+		TypeMeta: metav1.TypeMeta{APIVersion: Group + "/" + Version, Kind: Kind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "weekly-kill",
+			Namespace:         "redis",
+			Generation:        1,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec:   spec,
+		Status: status,
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(exp)
+	if err != nil {
+		panic(err)
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func validSpec() ExperimentSpec {
+	return ExperimentSpec{
+		// nothing listens there, so that the runs fail fast
+		Sentinel: "redis://127.0.0.1:1",
+		Target:   Target{StatefulSet: "redis"},
+		Fault:    FaultKill,
+	}
+}
+
+func newTestController(objs ...runtime.Object) *Controller {
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GVR: Kind + "List"},
+		objs...,
+	)
+	return NewController(fake.NewClientset(), dyn, "redis", time.Second, 10*time.Second)
+}
+
+func statusOf(t *testing.T, c *Controller) ExperimentStatus {
+	u, err := c.dynamic.Resource(GVR).Namespace("redis").Get(context.Background(), "weekly-kill", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := FromUnstructured(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exp.Status
+}
+
+func TestReconcile(t *testing.T) {
+	noTarget := validSpec()
+	noTarget.Target = Target{}
+	hourly := validSpec()
+	hourly.Schedule = "@hourly"
+	suspended := validSpec()
+	suspended.Suspend = true
+	tests := []struct {
+		name   string
+		spec   ExperimentSpec
+		status ExperimentStatus
+		now    time.Time
+		phase  string
+		runs   int
+		next   string
+	}{
+		{
+			name:  "without a target",
+			spec:  noTarget,
+			now:   created,
+			phase: PhaseInvalid,
+		},
+		{
+			name:   "interrupted",
+			spec:   validSpec(),
+			status: ExperimentStatus{Phase: PhaseRunning, Runs: 2},
+			now:    created,
+			phase:  PhaseFailed,
+			runs:   3,
+		},
+		{
+			name:  "not due yet",
+			spec:  hourly,
+			now:   created.Add(time.Minute),
+			phase: PhaseScheduled,
+			next:  "2026-10-19T11:00:00Z",
+		},
+		{
+			name:  "suspended",
+			spec:  suspended,
+			now:   created,
+			phase: PhaseScheduled,
+		},
+		{
+			name:   "ran once already",
+			spec:   validSpec(),
+			status: ExperimentStatus{Phase: PhaseSucceeded, Runs: 1, LastRun: &RunStatus{Result: PhaseSucceeded}},
+			now:    created,
+			phase:  PhaseSucceeded,
+			runs:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(experiment(tt.spec, tt.status))
+			u, err := c.dynamic.Resource(GVR).Namespace("redis").Get(context.Background(), "weekly-kill", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Reconcile(context.Background(), u, tt.now, make(chan map[string]string, 10)); err != nil {
+				t.Fatal(err)
+			}
+			if c.isRunning("redis/weekly-kill") {
+				t.Fatalf("unexpected run")
+			}
+			status := statusOf(t, c)
+			if status.Phase != tt.phase || status.Runs != tt.runs || status.NextRunTime != tt.next {
+				t.Errorf("expected %s, %d runs, next %q; got %s, %d runs, next %q (%s)", tt.phase, tt.runs, tt.next, status.Phase, status.Runs, status.NextRunTime, status.Message)
+			}
+		})
+	}
+}
+
+func TestReconcileRunsWhenDue(t *testing.T) {
+	c := newTestController(experiment(validSpec(), ExperimentStatus{}))
+	u, err := c.dynamic.Resource(GVR).Namespace("redis").Get(context.Background(), "weekly-kill", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq := make(chan map[string]string, 100)
+	if err := c.Reconcile(context.Background(), u, created, pq); err != nil {
+		t.Fatal(err)
+	}
+	// the run can't reach the sentinel, and fails
+	deadline := time.Now().Add(10 * time.Second)
+	for c.isRunning("redis/weekly-kill") {
+		if time.Now().After(deadline) {
+			t.Fatal("the run didn't finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := statusOf(t, c)
+	if status.Phase != PhaseFailed || status.Runs != 1 || status.LastRun == nil || status.LastRun.Result != PhaseFailed {
+		t.Errorf("expected a failed run; got %+v", status)
+	}
+	// and a one-off doesn't run again
+	u, err = c.dynamic.Resource(GVR).Namespace("redis").Get(context.Background(), "weekly-kill", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reconcile(context.Background(), u, created.Add(time.Hour), pq); err != nil {
+		t.Fatal(err)
+	}
+	if c.isRunning("redis/weekly-kill") || statusOf(t, c).Runs != 1 {
+		t.Errorf("expected no second run")
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	pod := func(name, owner string, lbls map[string]string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "redis", Labels: lbls}}
+		if owner != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: owner}}
+		}
+		return p
+	}
+	c := &Controller{clientset: fake.NewClientset(
+		pod("redis-0", "redis", map[string]string{"app": "redis"}),
+		pod("api-0", "api", map[string]string{"app": "api"}),
+		pod("loose", "", map[string]string{"app": "redis"}),
+	)}
+	tests := []struct {
+		pod    string
+		target Target
+		ok     bool
+	}{
+		{"redis-0", Target{StatefulSet: "redis"}, true},
+		{"redis-0", Target{Selector: "app=redis"}, true},
+		{"redis-0", Target{StatefulSet: "redis", Selector: "app=redis"}, true},
+		{"api-0", Target{StatefulSet: "redis"}, false},
+		{"api-0", Target{Selector: "app=redis"}, false},
+		{"loose", Target{StatefulSet: "redis"}, false},
+		{"loose", Target{StatefulSet: "redis", Selector: "app=redis"}, false},
+		{"gone", Target{Selector: "app=redis"}, false},
+	}
+	for _, tt := range tests {
+		exp := &Experiment{ObjectMeta: metav1.ObjectMeta{Namespace: "redis"}, Spec: ExperimentSpec{Target: tt.target}}
+		err := c.checkTarget(context.Background(), exp, tt.pod)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s with %+v: expected ok %v, got %v", tt.pod, tt.target, tt.ok, err)
+		}
+	}
+}
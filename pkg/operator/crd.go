@@ -0,0 +1,101 @@
+package operator
+
+// the CustomResourceDefinition of the experiments
+// built by hand, to avoid depending on the apiextensions types for a single object
+func CRD() map[string]any {
+	str := func(description string) map[string]any {
+		return map[string]any{"type": "string", "description": description}
+	}
+	return map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]any{
+			"name": Resource + "." + Group,
+			"labels": map[string]any{
+				"app.kubernetes.io/managed-by": "rr",
+			},
+		},
+		"spec": map[string]any{
+			"group": Group,
+			"scope": "Namespaced",
+			"names": map[string]any{
+				"kind":       Kind,
+				"listKind":   Kind + "List",
+				"plural":     Resource,
+				"singular":   "redischaosexperiment",
+				"shortNames": []any{"rce"},
+			},
+			"versions": []any{
+				map[string]any{
+					"name":    Version,
+					"served":  true,
+					"storage": true,
+					"subresources": map[string]any{
+						"status": map[string]any{},
+					},
+					"additionalPrinterColumns": []any{
+						map[string]any{"name": "Fault", "type": "string", "jsonPath": ".spec.fault"},
+						map[string]any{"name": "Schedule", "type": "string", "jsonPath": ".spec.schedule"},
+						map[string]any{"name": "Phase", "type": "string", "jsonPath": ".status.phase"},
+						map[string]any{"name": "Runs", "type": "integer", "jsonPath": ".status.runs"},
+						map[string]any{"name": "Last Run", "type": "date", "jsonPath": ".status.lastRun.startTime"},
+						map[string]any{"name": "Next Run", "type": "date", "jsonPath": ".status.nextRunTime"},
+					},
+					"schema": map[string]any{
+						"openAPIV3Schema": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"spec": map[string]any{
+									"type":     "object",
+									"required": []any{"fault", "target"},
+									"properties": map[string]any{
+										"sentinel":  str("Redis URL of the sentinel, like redis://redis:26379"),
+										"master":    str("Name of the master, mymaster by default"),
+										"secretRef": str("Secret in the same namespace, with the sentinel URL under sentinel-url"),
+										"target": map[string]any{
+											"type":        "object",
+											"description": "The pods the experiment may touch. It refuses to run when the master isn't one of them",
+											"properties": map[string]any{
+												"statefulSet": str("Name of the StatefulSet owning the redis pods"),
+												"selector":    str("Labels of the redis pods, like app=redis"),
+											},
+										},
+										"fault": map[string]any{
+											"type":        "string",
+											"description": "What to do to the master",
+											"enum":        []any{FaultKill, FaultFailover},
+										},
+										"schedule": str("Cron schedule, or @every <duration>. Runs once when empty"),
+										"suspend": map[string]any{
+											"type":        "boolean",
+											"description": "Don't start any new runs",
+										},
+										"abort": map[string]any{
+											"type": "object",
+											"properties": map[string]any{
+												"minHealthyReplicas": map[string]any{
+													"type":        "integer",
+													"minimum":     0,
+													"description": "Don't start unless at least this many replicas are healthy",
+												},
+												"requireQuorum": map[string]any{
+													"type":        "boolean",
+													"description": "Don't start unless the sentinels can failover, as per SENTINEL CKQUORUM",
+												},
+												"timeout": str("Give up when there's no new master after this long, 60s by default"),
+											},
+										},
+									},
+								},
+								"status": map[string]any{
+									"type":                                 "object",
+									"x-kubernetes-preserve-unknown-fields": true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,228 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/k8s"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const SecretSentinelURL = "sentinel-url"
+
+func (c *Controller) sentinelURL(ctx context.Context, exp *Experiment) (string, error) {
+	if exp.Spec.SecretRef == "" {
+		return exp.Spec.Sentinel, nil
+	}
+	secret, err := c.clientset.CoreV1().Secrets(exp.Namespace).Get(ctx, exp.Spec.SecretRef, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("can't get the secret %s in %s; got %s", exp.Spec.SecretRef, exp.Namespace, err)
+	}
+	if url, ok := secret.Data[SecretSentinelURL]; ok {
+		return string(url), nil
+	}
+	if exp.Spec.Sentinel == "" {
+		return "", fmt.Errorf("secret %s in %s has no %s", exp.Spec.SecretRef, exp.Namespace, SecretSentinelURL)
+	}
+	return exp.Spec.Sentinel, nil
+}
+
+func (e *Experiment) master() string {
+	if e.Spec.Master == "" {
+		return "mymaster"
+	}
+	return e.Spec.Master
+}
+
+// refuses to start when the deployment is already in trouble
+func checkAbortConditions(ctx context.Context, rdbs *redis.Client, master string, abort AbortConditions) error {
+	if abort.MinHealthyReplicas > 0 {
+		replicas, err := redisClient.GetReplicasFromSentinel(ctx, rdbs, master)
+		if err != nil {
+			return err
+		}
+		healthy := 0
+		for _, r := range replicas {
+			if !strings.Contains(r["flags"], "down") && !strings.Contains(r["flags"], "disconnected") && r["master-link-status"] == "ok" {
+				healthy++
+			}
+		}
+		if healthy < abort.MinHealthyReplicas {
+			return fmt.Errorf("only %d healthy replicas, need at least %d", healthy, abort.MinHealthyReplicas)
+		}
+	}
+	if abort.RequireQuorum {
+		if err := rdbs.Do(ctx, "SENTINEL", "ckquorum", master).Err(); err != nil {
+			return fmt.Errorf("no quorum to failover; got %s", err)
+		}
+	}
+	return nil
+}
+
+// refuses pods outside of the experiment's target
+func (c *Controller) checkTarget(ctx context.Context, exp *Experiment, name string) error {
+	pod, err := c.clientset.CoreV1().Pods(exp.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("can't get the pod %s in %s; got %s", name, exp.Namespace, err)
+	}
+	target := exp.Spec.Target
+	if target.StatefulSet != "" {
+		owned := false
+		for _, ref := range pod.OwnerReferences {
+			owned = owned || (ref.Kind == "StatefulSet" && ref.Name == target.StatefulSet)
+		}
+		if !owned {
+			return fmt.Errorf("the master %s isn't a pod of the StatefulSet %s; refusing to touch it", name, target.StatefulSet)
+		}
+	}
+	if target.Selector != "" {
+		selector, err := labels.Parse(target.Selector)
+		if err != nil {
+			return err
+		}
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			return fmt.Errorf("the master %s doesn't match the selector %s; refusing to touch it", name, target.Selector)
+		}
+	}
+	return nil
+}
+
+// injects the fault once, and waits for the sentinels to elect a new master
+func (c *Controller) run(ctx context.Context, exp *Experiment, pq chan map[string]string) *RunStatus {
+	start := time.Now()
+	res := &RunStatus{StartTime: start.UTC().Format(time.RFC3339)}
+	finish := func(result string, err error) *RunStatus {
+		res.Result = result
+		res.FinishTime = time.Now().UTC().Format(time.RFC3339)
+		res.Duration = time.Since(start).Round(time.Millisecond).String()
+		if err != nil {
+			res.Message = err.Error()
+		}
+		return res
+	}
+	url, err := c.sentinelURL(ctx, exp)
+	if err != nil {
+		return finish(PhaseFailed, err)
+	}
+	rdbs, err := redisClient.MakeRedisClient(url)
+	if err != nil {
+		return finish(PhaseFailed, err)
+	}
+	defer rdbs.Close()
+	master := exp.master()
+
+	// 1. Don't make things worse, if they're already bad
+	if err := checkAbortConditions(ctx, rdbs, master, exp.Spec.Abort); err != nil {
+		return finish(PhaseAborted, err)
+	}
+	oldMaster, err := redisClient.GetMasterFromSentinel(ctx, rdbs, master)
+	if err != nil {
+		return finish(PhaseFailed, err)
+	}
+	res.OldMaster = fmt.Sprintf("%s:%s", oldMaster.Host, oldMaster.Port)
+	pod, err := k8s.GuessPodNameFromHost(oldMaster.Host)
+	if err != nil {
+		return finish(PhaseFailed, err)
+	}
+
+	// whoever can create an experiment only gets to touch the pods it targets
+	if err := c.checkTarget(ctx, exp, pod); err != nil {
+		return finish(PhaseAborted, err)
+	}
+
+	// 2. Make sure nobody else (including rr outside of the operator) is at it
+	holder := fmt.Sprintf("rr operator (%s)", exp.Key())
+	lock, err := k8s.AcquireLock(ctx, c.clientset, master, exp.Namespace, holder, "operator "+exp.Spec.Fault, c.LockDuration)
+	if err != nil {
+		return finish(PhaseAborted, err)
+	}
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			pq <- map[string]string{
+				"event":      "lock not released",
+				"experiment": exp.Key(),
+				"msg":        err.Error(),
+			}
+		}
+	}()
+
+	// 3. Leave a trace on the pod, its StatefulSet and the experiment
+	var recorder *k8s.Recorder
+	record := func(reason, msg string) {
+		if recorder == nil {
+			return
+		}
+		if err := recorder.Event(ctx, reason, msg); err != nil {
+			pq <- map[string]string{
+				"event": "event not recorded",
+				"msg":   err.Error(),
+			}
+		}
+	}
+	id := fmt.Sprintf("%s run %d", exp.Key(), exp.Status.Runs+1)
+	recorder, err = k8s.NewRecorder(ctx, c.clientset, id, pod, exp.Namespace)
+	if err != nil {
+		return finish(PhaseFailed, err)
+	}
+	recorder.AddObject(corev1.ObjectReference{
+		APIVersion: Group + "/" + Version,
+		Kind:       Kind,
+		Name:       exp.Name,
+		Namespace:  exp.Namespace,
+		UID:        exp.UID,
+	})
+	if exp.Spec.Fault == FaultKill {
+		if err := recorder.Annotate(ctx); err != nil {
+			return finish(PhaseFailed, err)
+		}
+	}
+	record("ExperimentStarted", fmt.Sprintf("rr operator: %s %s", exp.Spec.Fault, res.OldMaster))
+
+	// 4. Inject the fault, and wait for the new master
+	rctx, cancel := context.WithTimeout(ctx, exp.Timeout())
+	defer cancel()
+	// buffered, so that the losers of the race don't block forever
+	done := make(chan error, 8)
+	// subscribed before the fault, not to miss the +switch-master of a quick failover
+	spubsub, err := redisClient.SubscribeSentinelEvents(rctx, rdbs)
+	if err != nil {
+		return finish(PhaseFailed, err)
+	}
+	go redisClient.WatchNewMaster(rctx, rdbs, spubsub, done, pq, oldMaster)
+	switch exp.Spec.Fault {
+	case FaultKill:
+		go k8s.KeepPodDead(rctx, c.clientset, pod, exp.Namespace, 0, done, pq)
+	case FaultFailover:
+		go func() {
+			if _, err := redisClient.Failover(rctx, rdbs, master); err != nil {
+				done <- err
+			}
+		}()
+	}
+	select {
+	case err = <-done:
+	case <-lock.Lost():
+		err = lock.Err()
+	case <-rctx.Done():
+		err = fmt.Errorf("no new master after %s", exp.Timeout())
+	}
+	cancel()
+
+	// 5. And see where we ended up
+	if newMaster, merr := redisClient.GetMasterFromSentinel(ctx, rdbs, master); merr == nil {
+		res.NewMaster = fmt.Sprintf("%s:%s", newMaster.Host, newMaster.Port)
+	}
+	result := PhaseSucceeded
+	if err != nil {
+		result = PhaseFailed
+	}
+	finish(result, err)
+	record("ExperimentFinished", fmt.Sprintf("rr operator: %s %s, new master %s after %s", exp.Spec.Fault, strings.ToLower(result), res.NewMaster, res.Duration))
+	return res
+}
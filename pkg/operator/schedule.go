@@ -0,0 +1,141 @@
+package operator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a cron schedule: minute, hour, day of month, month, day of week
+// or a fixed interval, with @every <duration>
+type Schedule struct {
+	every  time.Duration
+	fields [5]map[int]bool
+	// cron only matches either day field, when both are restricted
+	anyDom, anyDow bool
+}
+
+var scheduleRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+var scheduleAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("bad schedule %q; expected @every <duration of at least 1m>", spec)
+		}
+		return &Schedule{every: d}, nil
+	}
+	if alias, ok := scheduleAliases[spec]; ok {
+		spec = alias
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("bad schedule %q; expected 5 fields (minute hour day-of-month month day-of-week)", spec)
+	}
+	s := &Schedule{
+		anyDom: parts[2] == "*",
+		anyDow: parts[4] == "*",
+	}
+	for i, part := range parts {
+		values, err := parseScheduleField(part, scheduleRanges[i][0], scheduleRanges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("bad schedule %q; got %s", spec, err)
+		}
+		s.fields[i] = values
+	}
+	// 7 is also sunday
+	if s.fields[4][7] {
+		s.fields[4][0] = true
+	}
+	return s, nil
+}
+
+// parses things like *, 5, 1-5, */15, 0-30/10 and lists of them
+func parseScheduleField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("bad step in %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("bad value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("bad value in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		// day of week can be 7 for sunday
+		limit := max
+		if max == 6 {
+			limit = 7
+		}
+		if lo < min || hi > limit || lo > hi {
+			return nil, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// the first time the schedule fires after t
+// zero when it never does, like on the 30th of February
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	// the 29th of February can be 8 years away
+	limit := next.AddDate(9, 0, 0)
+	for next.Before(limit) {
+		if !s.matchesDay(next) {
+			y, m, d := next.Date()
+			next = time.Date(y, m, d+1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if s.fields[0][next.Minute()] && s.fields[1][next.Hour()] {
+			return next
+		}
+		next = next.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	if !s.fields[3][int(t.Month())] {
+		return false
+	}
+	dom, dow := s.fields[2][t.Day()], s.fields[4][int(t.Weekday())]
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
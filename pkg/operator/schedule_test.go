@@ -0,0 +1,84 @@
+package operator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"0 10 * * 2", true},
+		{"*/15 0-6,22-23 1 1-12/2 7", true},
+		{"@daily", true},
+		{"@every 1h", true},
+		{"@every 30s", false},
+		{"@every soon", false},
+		{"* * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchedule(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: expected ok %v, got %v", tt.spec, tt.ok, err)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		spec string
+		from string
+		next string
+	}{
+		{"* * * * *", "2026-10-19T10:02:30Z", "2026-10-19T10:03:00Z"},
+		{"*/15 * * * *", "2026-10-19T10:02:00Z", "2026-10-19T10:15:00Z"},
+		{"*/15 * * * *", "2026-10-19T10:15:00Z", "2026-10-19T10:30:00Z"},
+		{"0 10 * * *", "2026-10-19T10:00:00Z", "2026-10-20T10:00:00Z"},
+		{"@hourly", "2026-10-19T23:59:00Z", "2026-10-20T00:00:00Z"},
+		// a Tuesday
+		{"0 10 * * 2", "2026-10-19T12:00:00Z", "2026-10-20T10:00:00Z"},
+		// 7 is sunday too
+		{"0 0 * * 7", "2026-10-19T12:00:00Z", "2026-10-25T00:00:00Z"},
+		{"0 0 1 1 *", "2026-10-19T12:00:00Z", "2027-01-01T00:00:00Z"},
+		// with both days restricted, either matches: the 1st, or a Friday
+		{"0 0 1 * 5", "2026-10-19T12:00:00Z", "2026-10-23T00:00:00Z"},
+		{"0 0 29 2 *", "2026-10-19T12:00:00Z", "2028-02-29T00:00:00Z"},
+		{"@every 90m", "2026-10-19T10:02:30Z", "2026-10-19T11:32:30Z"},
+		// never
+		{"0 0 30 2 *", "2026-10-19T12:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.spec, err)
+		}
+		next := s.Next(at(tt.from))
+		if tt.next == "" {
+			if !next.IsZero() {
+				t.Errorf("%q from %s: expected never, got %s", tt.spec, tt.from, next)
+			}
+			continue
+		}
+		if !next.Equal(at(tt.next)) {
+			t.Errorf("%q from %s: expected %s, got %s", tt.spec, tt.from, tt.next, next.Format(time.RFC3339))
+		}
+	}
+}
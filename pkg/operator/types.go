@@ -0,0 +1,155 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group    = "rr.seeker89.io"
+	Version  = "v1alpha1"
+	Kind     = "RedisChaosExperiment"
+	Resource = "redischaosexperiments"
+)
+
+var GVR = schema.GroupVersionResource{Group: Group, Version: Version, Resource: Resource}
+
+// the faults an experiment can inject
+const (
+	FaultKill     = "kill"
+	FaultFailover = "failover"
+)
+
+var Faults = []string{FaultKill, FaultFailover}
+
+// the phases of an experiment
+const (
+	PhaseScheduled = "Scheduled"
+	PhaseRunning   = "Running"
+	PhaseSucceeded = "Succeeded"
+	PhaseFailed    = "Failed"
+	PhaseAborted   = "Aborted"
+	PhaseInvalid   = "Invalid"
+)
+
+// there's no typed client for our resource, so it's converted from the unstructured one
+type Experiment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ExperimentSpec   `json:"spec"`
+	Status ExperimentStatus `json:"status,omitempty"`
+}
+
+type ExperimentSpec struct {
+	// redis URL of the sentinel service, like redis://redis:26379
+	Sentinel string `json:"sentinel"`
+	// the master name
+	Master string `json:"master,omitempty"`
+	// a Secret in the same namespace, with the key sentinel-url overriding the above
+	// so that the password doesn't need to be in the experiment
+	SecretRef string `json:"secretRef,omitempty"`
+	// the pods the experiment may touch; it refuses to run when the master isn't one of them
+	Target Target `json:"target"`
+	// what to do to the master
+	Fault string `json:"fault"`
+	// standard cron schedule, or @every <duration>; runs once when empty
+	Schedule string `json:"schedule,omitempty"`
+	// stop scheduling new runs
+	Suspend bool `json:"suspend,omitempty"`
+	// when not to run, and when to give up
+	Abort AbortConditions `json:"abort,omitempty"`
+}
+
+// at least one is required; with both, the pod needs to match both
+type Target struct {
+	// name of the StatefulSet owning the redis pods
+	StatefulSet string `json:"statefulSet,omitempty"`
+	// labels of the redis pods, like app=redis
+	Selector string `json:"selector,omitempty"`
+}
+
+type AbortConditions struct {
+	// don't start unless at least this many replicas are healthy
+	MinHealthyReplicas int `json:"minHealthyReplicas,omitempty"`
+	// don't start unless the sentinels have the quorum to failover, as per SENTINEL CKQUORUM
+	RequireQuorum bool `json:"requireQuorum,omitempty"`
+	// give up if there's no new master after this long, 60s by default
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type ExperimentStatus struct {
+	Phase              string     `json:"phase,omitempty"`
+	Message            string     `json:"message,omitempty"`
+	Runs               int        `json:"runs,omitempty"`
+	NextRunTime        string     `json:"nextRunTime,omitempty"`
+	LastRun            *RunStatus `json:"lastRun,omitempty"`
+	ObservedGeneration int64      `json:"observedGeneration,omitempty"`
+}
+
+type RunStatus struct {
+	StartTime  string `json:"startTime,omitempty"`
+	FinishTime string `json:"finishTime,omitempty"`
+	Result     string `json:"result,omitempty"`
+	OldMaster  string `json:"oldMaster,omitempty"`
+	NewMaster  string `json:"newMaster,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func FromUnstructured(u *unstructured.Unstructured) (*Experiment, error) {
+	exp := &Experiment{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, exp); err != nil {
+		return nil, fmt.Errorf("can't read %s %s/%s; got %s", Kind, u.GetNamespace(), u.GetName(), err)
+	}
+	return exp, nil
+}
+
+func (e *Experiment) Key() string {
+	return e.Namespace + "/" + e.Name
+}
+
+func (e *Experiment) Timeout() time.Duration {
+	timeout, err := time.ParseDuration(e.Spec.Abort.Timeout)
+	if err != nil || timeout <= 0 {
+		return 60 * time.Second
+	}
+	return timeout
+}
+
+// what's wrong with the spec, if anything
+func (e *Experiment) Validate() error {
+	if e.Spec.Sentinel == "" && e.Spec.SecretRef == "" {
+		return fmt.Errorf("spec.sentinel is required")
+	}
+	if e.Spec.Target.StatefulSet == "" && e.Spec.Target.Selector == "" {
+		return fmt.Errorf("spec.target.statefulSet or spec.target.selector is required")
+	}
+	if e.Spec.Target.Selector != "" {
+		if _, err := labels.Parse(e.Spec.Target.Selector); err != nil {
+			return fmt.Errorf("bad spec.target.selector; got %s", err)
+		}
+	}
+	switch e.Spec.Fault {
+	case FaultKill, FaultFailover:
+	default:
+		return fmt.Errorf("spec.fault must be one of %q; got %q", Faults, e.Spec.Fault)
+	}
+	if e.Spec.Schedule != "" {
+		if _, err := ParseSchedule(e.Spec.Schedule); err != nil {
+			return err
+		}
+	}
+	if e.Spec.Abort.Timeout != "" {
+		if _, err := time.ParseDuration(e.Spec.Abort.Timeout); err != nil {
+			return fmt.Errorf("bad spec.abort.timeout; got %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/history"
+)
+
+// a single operation issued by the probe
+type Result struct {
+	Start   time.Time
+	Latency time.Duration
+	Op      string
+	Err     error
+	// a read that didn't return what was just written
+	Stale bool
+	// the node that served it, as host:port, when the probe has a Tracker
+	Addr string
+}
+
+// dials the nodes for a client, remembering the address of the connection written to last
+// the probe issues one command at a time, so that's the node serving it
+type Tracker struct {
+	TLSConfig *tls.Config
+	// not the nodes serving the commands, like the sentinels a FailoverClient dials the same way
+	Ignore []string
+
+	last atomic.Pointer[string]
+}
+
+// for the Dialer in the client's options
+func (t *Tracker) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 5 * time.Minute}
+	var conn net.Conn
+	var err error
+	if t.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, network, addr, t.TLSConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, network, addr)
+	}
+	if err != nil || slices.Contains(t.Ignore, addr) {
+		return conn, err
+	}
+	return &trackedConn{Conn: conn, addr: addr, tracker: t}, nil
+}
+
+func (t *Tracker) Last() string {
+	if addr := t.last.Load(); addr != nil {
+		return *addr
+	}
+	return ""
+}
+
+func (t *Tracker) reset() {
+	t.last.Store(nil)
+}
+
+type trackedConn struct {
+	net.Conn
+	addr    string
+	tracker *Tracker
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	c.tracker.last.Store(&c.addr)
+	return c.Conn.Write(b)
+}
+
+// the kinds of errors clients run into during a failover
+const (
+	// writing to a replica, like a client still talking to the demoted master
+	ErrorReadOnly = "readonly"
+	// the node is down, or not up yet
+	ErrorConnectionRefused = "connection_refused"
+	// the node, or the network, is unresponsive
+	ErrorTimeout = "timeout"
+	// the node is up, but still loading the dataset
+	ErrorLoading = "loading"
+	// a replica with replica-serve-stale-data off, cut off from its master
+	ErrorMasterDown = "masterdown"
+	ErrorOther      = "other"
+)
+
+var ErrorTypes = []string{ErrorReadOnly, ErrorConnectionRefused, ErrorTimeout, ErrorLoading, ErrorMasterDown, ErrorOther}
+
+// tells which of the ErrorTypes the error is
+func ErrorType(err error) string {
+	var netErr net.Error
+	switch {
+	case redis.HasErrorPrefix(err, "READONLY"):
+		return ErrorReadOnly
+	case redis.HasErrorPrefix(err, "LOADING"):
+		return ErrorLoading
+	case redis.HasErrorPrefix(err, "MASTERDOWN"):
+		return ErrorMasterDown
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorConnectionRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	}
+	return ErrorOther
+}
+
+// a period of time when the probe saw errors or slow responses
+type Window struct {
+	Start  time.Time
+	End    time.Time
+	Errors int
+	Slow   int
+}
+
+// issues a write and a read at a fixed rate, and keeps track of what the client experienced
+type Probe struct {
+	Name     string
+	Client   redis.UniversalClient
+	Key      string
+	Interval time.Duration
+	Slow     time.Duration
+	// optionally, where to record every operation
+	History *history.Recorder
+	// optionally, the Dialer of the client, to tell which node served each operation
+	Tracker *Tracker
+
+	mu      sync.Mutex
+	results []Result
+	windows []Window
+}
+
+func NewProbe(name string, client redis.UniversalClient, key string, interval, slow time.Duration) *Probe {
+	return &Probe{
+		Name:     name,
+		Client:   client,
+		Key:      key,
+		Interval: interval,
+		Slow:     slow,
+	}
+}
+
+func (p *Probe) do(ctx context.Context, op string, f func(ctx context.Context) error) Result {
+	if p.Tracker != nil {
+		p.Tracker.reset()
+	}
+	start := time.Now()
+	err := f(ctx)
+	if err == redis.Nil {
+		err = nil
+	}
+	r := Result{
+		Start:   start,
+		Latency: time.Since(start),
+		Op:      op,
+		Err:     err,
+	}
+	if p.Tracker != nil {
+		r.Addr = p.Tracker.Last()
+	}
+	return r
+}
+
+// runs until the context is cancelled
+// emits an event when the client starts and stops having problems
+func (p *Probe) Run(ctx context.Context, pq chan map[string]string) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	var window *Window
+	var i int64
+	for {
+		select {
+		case <-ctx.Done():
+			if window != nil {
+				window.End = time.Now()
+				p.closeWindow(*window, pq)
+			}
+			return
+		case <-ticker.C:
+		}
+		i++
+		invoke := p.History.Invoke(p.Name, history.Write, p.Key, history.Value(i))
+		set := p.do(ctx, "set", func(ctx context.Context) error {
+			return p.Client.Set(ctx, p.Key, i, 0).Err()
+		})
+		p.History.Complete(invoke, nil, set.Err)
+		var got int64
+		invoke = p.History.Invoke(p.Name, history.Read, p.Key, nil)
+		get := p.do(ctx, "get", func(ctx context.Context) error {
+			var err error
+			got, err = p.Client.Get(ctx, p.Key).Int64()
+			return err
+		})
+		// 0 is never written, so that's the key missing
+		var read *string
+		if get.Err == nil && got != 0 {
+			read = history.Value(got)
+		}
+		p.History.Complete(invoke, read, get.Err)
+		// like when the read is served by a replica that's behind, or by the wrong master
+		get.Stale = set.Err == nil && get.Err == nil && got != i
+		results := []Result{set, get}
+		for _, r := range results {
+			if ctx.Err() != nil {
+				break
+			}
+			p.mu.Lock()
+			p.results = append(p.results, r)
+			p.mu.Unlock()
+			slow := r.Latency > p.Slow
+			if r.Err == nil && !slow {
+				if window != nil {
+					window.End = r.Start
+					p.closeWindow(*window, pq)
+					window = nil
+				}
+				continue
+			}
+			if window == nil {
+				window = &Window{Start: r.Start}
+				msg := fmt.Sprintf("%s slow (%s)", r.Op, r.Latency)
+				if r.Err != nil {
+					msg = fmt.Sprintf("%s failed: %s", r.Op, r.Err)
+				}
+				pq <- map[string]string{
+					"event": "probe degraded",
+					"probe": p.Name,
+					"msg":   msg,
+				}
+			}
+			if r.Err != nil {
+				window.Errors++
+			} else {
+				window.Slow++
+			}
+		}
+	}
+}
+
+func (p *Probe) closeWindow(w Window, pq chan map[string]string) {
+	p.mu.Lock()
+	p.windows = append(p.windows, w)
+	p.mu.Unlock()
+	pq <- map[string]string{
+		"event":    "probe recovered",
+		"probe":    p.Name,
+		"msg":      w.End.Sub(w.Start).String(),
+		"errors":   fmt.Sprint(w.Errors),
+		"slow":     fmt.Sprint(w.Slow),
+		"started":  w.Start.String(),
+		"finished": w.End.String(),
+	}
+}
+
+func (p *Probe) Results() []Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Result{}, p.results...)
+}
+
+func (p *Probe) Windows() []Window {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Window{}, p.windows...)
+}
+
+// returns the first successful operation of the kind, started after the given time
+// and served by the node at addr, unless empty
+func (p *Probe) FirstSuccess(op, addr string, after time.Time) (Result, bool) {
+	for _, r := range p.Results() {
+		if r.Op == op && r.Err == nil && r.Start.After(after) && (addr == "" || r.Addr == addr) {
+			return r, true
+		}
+	}
+	return Result{}, false
+}
+
+// returns the given percentile (0-100) of the latencies
+func Percentile(latencies []time.Duration, pct float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(len(sorted)-1) * pct / 100)
+	return sorted[idx]
+}
+
+// summarises everything the probe saw so far
+func (p *Probe) Summary() map[string]string {
+	results := p.Results()
+	windows := p.Windows()
+	errors, stale := 0, 0
+	types := map[string]int{}
+	latencies := []time.Duration{}
+	for _, r := range results {
+		if r.Stale {
+			stale++
+		}
+		if r.Err != nil {
+			errors++
+			types[ErrorType(r.Err)]++
+			continue
+		}
+		latencies = append(latencies, r.Latency)
+	}
+	var degraded, unavailable, longest time.Duration
+	for _, w := range windows {
+		d := w.End.Sub(w.Start)
+		degraded += d
+		// the windows with nothing but slow responses don't count
+		if w.Errors > 0 {
+			unavailable += d
+		}
+		if d > longest {
+			longest = d
+		}
+	}
+	summary := map[string]string{
+		"probe":          p.Name,
+		"ops":            fmt.Sprint(len(results)),
+		"errors":         fmt.Sprint(errors),
+		"stale_reads":    fmt.Sprint(stale),
+		"windows":        fmt.Sprint(len(windows)),
+		"degraded":       degraded.String(),
+		"unavailable":    unavailable.String(),
+		"longest_window": longest.String(),
+		"p50":            Percentile(latencies, 50).String(),
+		"p99":            Percentile(latencies, 99).String(),
+		"max":            Percentile(latencies, 100).String(),
+	}
+	for _, t := range ErrorTypes {
+		summary["errors_"+t] = fmt.Sprint(types[t])
+	}
+	return summary
+}
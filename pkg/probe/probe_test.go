@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFirstSuccess(t *testing.T) {
+	fault := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return fault.Add(time.Duration(s) * time.Second) }
+	p := &Probe{results: []Result{
+		{Start: at(-1), Op: "set", Addr: "10.0.0.1:6379"},
+		// the old master, still taking writes
+		{Start: at(1), Op: "set", Addr: "10.0.0.1:6379"},
+		{Start: at(2), Op: "set", Addr: "10.0.0.2:6379", Err: errors.New("READONLY")},
+		{Start: at(3), Op: "get", Addr: "10.0.0.2:6379"},
+		{Start: at(4), Op: "set", Addr: "10.0.0.2:6379"},
+	}}
+	tests := []struct {
+		addr string
+		want time.Time
+		ok   bool
+	}{
+		{"", at(1), true},
+		{"10.0.0.1:6379", at(1), true},
+		{"10.0.0.2:6379", at(4), true},
+		{"10.0.0.3:6379", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		r, ok := p.FirstSuccess("set", tt.addr, fault)
+		if ok != tt.ok || !r.Start.Equal(tt.want) {
+			t.Errorf("%q: expected %s %v, got %s %v", tt.addr, tt.want, tt.ok, r.Start, ok)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	listen := func() net.Listener {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					buf := make([]byte, 64)
+					for {
+						if _, err := conn.Read(buf); err != nil {
+							return
+						}
+					}
+				}()
+			}
+		}()
+		return l
+	}
+	a, b := listen(), listen()
+	defer a.Close()
+	defer b.Close()
+	tracker := &Tracker{}
+	ca, err := tracker.Dial(context.Background(), "tcp", a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Close()
+	cb, err := tracker.Dial(context.Background(), "tcp", b.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cb.Close()
+	sentinel := &Tracker{Ignore: []string{a.Addr().String()}}
+	cs, err := sentinel.Dial(context.Background(), "tcp", a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	if _, err := cs.Write([]byte("PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if sentinel.Last() != "" {
+		t.Errorf("expected the ignored address not to count; got %s", sentinel.Last())
+	}
+	if tracker.Last() != "" {
+		t.Errorf("expected nothing written yet; got %s", tracker.Last())
+	}
+	for _, c := range []struct {
+		conn net.Conn
+		addr string
+	}{{ca, a.Addr().String()}, {cb, b.Addr().String()}, {ca, a.Addr().String()}} {
+		if _, err := c.conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		if tracker.Last() != c.addr {
+			t.Errorf("expected %s, got %s", c.addr, tracker.Last())
+		}
+	}
+}
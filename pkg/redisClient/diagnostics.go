@@ -0,0 +1,60 @@
+package redisClient
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const Redacted = "<redacted>"
+
+func GetSentinelsFromSentinel(ctx context.Context, rdb *redis.Client, master string) ([]map[string]string, error) {
+	cmd := redis.NewMapStringStringSliceCmd(ctx, "SENTINEL", "sentinels", master)
+	if err := rdb.Process(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return cmd.Result()
+}
+
+func GetMasterDetailsFromSentinel(ctx context.Context, rdb *redis.Client, master string) (map[string]string, error) {
+	cmd := redis.NewMapStringStringCmd(ctx, "SENTINEL", "master", master)
+	if err := rdb.Process(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return cmd.Result()
+}
+
+// whether the config parameter holds credentials, like requirepass, masterauth or sentinel-pass
+func IsSecretConfig(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"pass", "auth", "secret"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// the whole config of the node, with the credentials redacted
+// sentinel has its own CONFIG GET, under SENTINEL, with different parameters
+func GetRedactedConfig(ctx context.Context, rdb *redis.Client, sentinel bool) (map[string]string, error) {
+	args := []any{"CONFIG", "GET", "*"}
+	if sentinel {
+		args = append([]any{"SENTINEL"}, args...)
+	}
+	cmd := redis.NewMapStringStringCmd(ctx, args...)
+	if err := rdb.Process(ctx, cmd); err != nil {
+		return nil, err
+	}
+	config, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range config {
+		if v != "" && IsSecretConfig(k) {
+			config[k] = Redacted
+		}
+	}
+	return config, nil
+}
@@ -30,6 +30,32 @@ func MakeRedisClient(url string) (*redis.Client, error) {
 	return redis.NewClient(opts), nil
 }
 
+// options for a sentinel-aware client, which always talks to the current master
+// auth for the sentinel comes from sentinelURL, auth for the nodes from redisURL
+func MakeFailoverOptions(sentinelURL, redisURL, master string) (*redis.FailoverOptions, error) {
+	sopts, err := redis.ParseURL(sentinelURL)
+	if err != nil {
+		return nil, err
+	}
+	if redisURL == "" {
+		redisURL = "redis://"
+	}
+	ropts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redis.FailoverOptions{
+		MasterName:       master,
+		SentinelAddrs:    []string{sopts.Addr},
+		SentinelUsername: sopts.Username,
+		SentinelPassword: sopts.Password,
+		Username:         ropts.Username,
+		Password:         ropts.Password,
+		DB:               ropts.DB,
+		TLSConfig:        ropts.TLSConfig,
+	}, nil
+}
+
 func GetMasterFromSentinel(ctx context.Context, rdb *redis.Client, master string) (*RedisInstance, error) {
 	cmd := rdb.Do(ctx, "SENTINEL", "get-master-addr-by-name", master)
 	if err := rdb.Process(ctx, cmd); err != nil {
@@ -46,6 +72,15 @@ func GetMasterFromSentinel(ctx context.Context, rdb *redis.Client, master string
 	}, nil
 }
 
+// asks the sentinel to failover the master, without waiting for the other sentinels
+func Failover(ctx context.Context, rdb *redis.Client, master string) (string, error) {
+	cmd := rdb.Do(ctx, "SENTINEL", "failover", master)
+	if err := rdb.Process(ctx, cmd); err != nil {
+		return "", err
+	}
+	return cmd.Text()
+}
+
 func ParseSwitchMasterMessage(msg string) (*RedisSwitchMasterEvent, error) {
 	parts := strings.Split(msg, " ")
 	if len(parts) != 5 {
@@ -67,9 +102,38 @@ func WaitForNewMaster(
 	pq chan map[string]string,
 	oldMaster *RedisInstance,
 ) {
-	// listen in on new sentinel events
+	spubsub, err := SubscribeSentinelEvents(ctx, rdbs)
+	if err != nil {
+		done <- err
+		return
+	}
+	WatchNewMaster(ctx, rdbs, spubsub, done, pq, oldMaster)
+}
+
+// listens in on new sentinel events, and returns once the sentinel confirmed the subscription,
+// so that nothing it publishes after that is missed, like the +switch-master of a failover requested next
+func SubscribeSentinelEvents(ctx context.Context, rdbs *redis.Client) (*redis.PubSub, error) {
 	spubsub := rdbs.PSubscribe(ctx, "+*")
-	defer spubsub.Close()
+	if _, err := spubsub.Receive(ctx); err != nil {
+		spubsub.Close()
+		return nil, err
+	}
+	return spubsub, nil
+}
+
+// like WaitForNewMaster, on a subscription from SubscribeSentinelEvents, which it closes with the context
+func WatchNewMaster(
+	ctx context.Context,
+	rdbs *redis.Client,
+	spubsub *redis.PubSub,
+	done chan error,
+	pq chan map[string]string,
+	oldMaster *RedisInstance,
+) {
+	go func() {
+		<-ctx.Done()
+		spubsub.Close()
+	}()
 	for msg := range spubsub.Channel() {
 		switch msg.Channel {
 		case "+switch-master":
@@ -120,3 +184,58 @@ func WaitForNewMaster(
 		}
 	}
 }
+
+// sends every +switch-master for the master, until the context is cancelled
+func WatchSwitchMaster(
+	ctx context.Context,
+	rdbs *redis.Client,
+	master string,
+	events chan *RedisSwitchMasterEvent,
+	pq chan map[string]string,
+) {
+	spubsub := rdbs.Subscribe(ctx, "+switch-master")
+	go func() {
+		<-ctx.Done()
+		spubsub.Close()
+	}()
+	for msg := range spubsub.Channel() {
+		evt, err := ParseSwitchMasterMessage(msg.Payload)
+		if err != nil {
+			pq <- map[string]string{
+				"event": "bad message",
+				"msg":   err.Error(),
+			}
+			continue
+		}
+		if evt.Master != master {
+			continue
+		}
+		// nobody may be reading anymore, once the run is over
+		select {
+		case events <- evt:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// emits all the sentinel events matching the pattern, until the context is cancelled
+func ForwardSentinelEvents(
+	ctx context.Context,
+	rdbs *redis.Client,
+	pattern string,
+	pq chan map[string]string,
+) {
+	spubsub := rdbs.PSubscribe(ctx, pattern)
+	go func() {
+		<-ctx.Done()
+		spubsub.Close()
+	}()
+	for msg := range spubsub.Channel() {
+		pq <- map[string]string{
+			"event": "sentinel",
+			"ch":    msg.Channel,
+			"msg":   msg.Payload,
+		}
+	}
+}
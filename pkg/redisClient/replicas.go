@@ -0,0 +1,352 @@
+package redisClient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisInstanceEvent struct {
+	Type       string
+	Name       string
+	Host       string
+	Port       string
+	Master     string
+	MasterHost string
+	MasterPort string
+}
+
+// options to connect to a node directly, reusing the options (auth, db, tls) from the url
+// an empty url means no auth
+func MakeNodeOptions(url string, node *RedisInstance) (*redis.Options, error) {
+	if url == "" {
+		url = "redis://"
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	opts.Addr = net.JoinHostPort(node.Host, node.Port)
+	return opts, nil
+}
+
+func MakeNodeClient(url string, node *RedisInstance) (*redis.Client, error) {
+	opts, err := MakeNodeOptions(url, node)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
+}
+
+func GetReplicasFromSentinel(ctx context.Context, rdb *redis.Client, master string) ([]map[string]string, error) {
+	cmd := redis.NewMapStringStringSliceCmd(ctx, "SENTINEL", "replicas", master)
+	if err := rdb.Process(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return cmd.Result()
+}
+
+// parses the output of INFO into a flat key -> value map
+func ParseInfo(info string) map[string]string {
+	res := map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// parses values like "ip=10.0.0.1,port=6379,state=online,offset=42,lag=0"
+func ParseInfoValue(value string) map[string]string {
+	res := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func GetReplicationInfo(ctx context.Context, rdb *redis.Client) (map[string]string, error) {
+	info, err := rdb.Info(ctx, "replication").Result()
+	if err != nil {
+		return nil, err
+	}
+	return ParseInfo(info), nil
+}
+
+// returns how many bytes the replica is behind the master, as seen by the master
+func GetReplicaLag(ctx context.Context, rdb *redis.Client, replica *RedisInstance) (int64, error) {
+	info, err := GetReplicationInfo(ctx, rdb)
+	if err != nil {
+		return 0, err
+	}
+	masterOffset, err := strconv.ParseInt(info["master_repl_offset"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse master_repl_offset; got %s", err)
+	}
+	for k, v := range info {
+		if !strings.HasPrefix(k, "slave") || k == "slave_read_repl_offset" {
+			continue
+		}
+		slave := ParseInfoValue(v)
+		if slave["ip"] != replica.Host || slave["port"] != replica.Port {
+			continue
+		}
+		offset, err := strconv.ParseInt(slave["offset"], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("can't parse the offset of %s; got %s", k, err)
+		}
+		return masterOffset - offset, nil
+	}
+	return 0, fmt.Errorf("replica %s:%s not connected to the master", replica.Host, replica.Port)
+}
+
+// parses messages like "slave <name> <ip> <port> @ <master> <master ip> <master port>"
+func ParseInstanceMessage(msg string) (*RedisInstanceEvent, error) {
+	parts := strings.Split(msg, " ")
+	if len(parts) != 8 || parts[4] != "@" {
+		return nil, fmt.Errorf("expected formatted redis instance details, got %s", msg)
+	}
+	return &RedisInstanceEvent{
+		Type:       parts[0],
+		Name:       parts[1],
+		Host:       parts[2],
+		Port:       parts[3],
+		Master:     parts[5],
+		MasterHost: parts[6],
+		MasterPort: parts[7],
+	}, nil
+}
+
+// waits until the sentinel reports the node back as a working replica
+// either by (re)configuring it, or by clearing its subjectively down state
+func WaitForReplica(
+	ctx context.Context,
+	rdbs *redis.Client,
+	done chan error,
+	pq chan map[string]string,
+	node *RedisInstance,
+) {
+	spubsub := rdbs.Subscribe(ctx, "+slave", "+convert-to-slave", "-sdown")
+	defer spubsub.Close()
+	// the events may have fired before we subscribed, so once subscribed, check where the node is at
+	if _, err := spubsub.Receive(ctx); err != nil {
+		done <- err
+		return
+	}
+	replicas, err := GetReplicasFromSentinel(ctx, rdbs, node.Master)
+	if err != nil {
+		done <- err
+		return
+	}
+	if IsHealthyReplica(replicas, node) {
+		pq <- map[string]string{
+			"event": "replica reported",
+			"msg":   fmt.Sprintf("already a replica %s:%s", node.Host, node.Port),
+		}
+		done <- nil
+		return
+	}
+	for msg := range spubsub.Channel() {
+		evt, err := ParseInstanceMessage(msg.Payload)
+		if err != nil {
+			// -sdown is also sent for masters & sentinels, in different format
+			continue
+		}
+		pq <- map[string]string{
+			"debug": "true",
+			"event": "sentinel",
+			"ch":    msg.Channel,
+			"msg":   msg.Payload,
+		}
+		if evt.Type != "slave" || evt.Master != node.Master || evt.Host != node.Host || evt.Port != node.Port {
+			continue
+		}
+		pq <- map[string]string{
+			"event": "replica reported",
+			"msg":   fmt.Sprintf("%s %s:%s", msg.Channel, evt.Host, evt.Port),
+		}
+		done <- nil
+		return
+	}
+}
+
+// whether the sentinel lists the node as a replica that isn't down
+func IsHealthyReplica(replicas []map[string]string, node *RedisInstance) bool {
+	for _, r := range replicas {
+		if r["ip"] != node.Host || r["port"] != node.Port {
+			continue
+		}
+		flags := strings.Split(r["flags"], ",")
+		return slices.Contains(flags, "slave") &&
+			!slices.Contains(flags, "s_down") &&
+			!slices.Contains(flags, "o_down") &&
+			!slices.Contains(flags, "disconnected")
+	}
+	return false
+}
+
+// polls the sentinel until the replica's link to the master is up,
+// and then the master until the replica is no more than maxLag bytes behind
+// negative maxLag skips the second part, and relies on the sentinel alone
+func WaitForReplicaSync(
+	ctx context.Context,
+	rdbs *redis.Client,
+	nodeURL string,
+	maxLag int64,
+	interval time.Duration,
+	done chan error,
+	pq chan map[string]string,
+	node *RedisInstance,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	linked := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !linked {
+			replicas, err := GetReplicasFromSentinel(ctx, rdbs, node.Master)
+			if err != nil {
+				done <- err
+				return
+			}
+			for _, r := range replicas {
+				if r["ip"] == node.Host && r["port"] == node.Port && r["master-link-status"] == "ok" {
+					linked = true
+				}
+			}
+			if !linked {
+				continue
+			}
+			pq <- map[string]string{
+				"event": "replica link ok",
+				"msg":   fmt.Sprintf("%s:%s", node.Host, node.Port),
+			}
+			if maxLag < 0 {
+				done <- nil
+				return
+			}
+		}
+		master, err := GetMasterFromSentinel(ctx, rdbs, node.Master)
+		if err != nil {
+			done <- err
+			return
+		}
+		rdb, err := MakeNodeClient(nodeURL, master)
+		if err != nil {
+			done <- err
+			return
+		}
+		lag, err := GetReplicaLag(ctx, rdb, node)
+		rdb.Close()
+		if err != nil {
+			pq <- map[string]string{
+				"debug": "true",
+				"event": "replica lag",
+				"msg":   err.Error(),
+			}
+			continue
+		}
+		if lag > maxLag {
+			pq <- map[string]string{
+				"debug": "true",
+				"event": "replica lag",
+				"msg":   fmt.Sprint(lag),
+			}
+			continue
+		}
+		pq <- map[string]string{
+			"event": "replica in sync",
+			"msg":   fmt.Sprintf("%s:%s", node.Host, node.Port),
+			"lag":   fmt.Sprint(lag),
+		}
+		done <- nil
+		return
+	}
+}
+
+// polls the replica directly until it finishes a full sync with its master
+// returns how long it took and how much data was transferred, as far as we could observe
+func WaitForFullSync(
+	ctx context.Context,
+	nodeURL string,
+	interval time.Duration,
+	pq chan map[string]string,
+	node *RedisInstance,
+) (map[string]string, error) {
+	rdb, err := MakeNodeClient(nodeURL, node)
+	if err != nil {
+		return nil, err
+	}
+	defer rdb.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var started time.Time
+	res := map[string]string{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		info, err := GetReplicationInfo(ctx, rdb)
+		if err != nil {
+			// expected while the pod is coming back
+			pq <- map[string]string{
+				"debug": "true",
+				"event": "replica info",
+				"msg":   err.Error(),
+			}
+			continue
+		}
+		if info["master_sync_in_progress"] == "1" {
+			if started.IsZero() {
+				started = time.Now()
+				pq <- map[string]string{
+					"event": "full sync started",
+					"msg":   fmt.Sprintf("%s:%s", node.Host, node.Port),
+				}
+			}
+			// -1 for diskless sync
+			res["sync_total_bytes"] = info["master_sync_total_bytes"]
+			res["sync_read_bytes"] = info["master_sync_read_bytes"]
+			continue
+		}
+		if info["role"] != "slave" || info["master_link_status"] != "up" {
+			continue
+		}
+		res["repl_offset"] = info["master_repl_offset"]
+		if !started.IsZero() {
+			res["sync_duration"] = time.Since(started).String()
+		}
+		evt := map[string]string{
+			"event": "full sync finished",
+			"msg":   fmt.Sprintf("%s:%s", node.Host, node.Port),
+		}
+		for k, v := range res {
+			evt[k] = v
+		}
+		pq <- evt
+		return res, nil
+	}
+}
@@ -0,0 +1,25 @@
+package redisClient
+
+import "testing"
+
+func TestIsHealthyReplica(t *testing.T) {
+	node := &RedisInstance{Host: "10.0.0.1", Port: "6379", Master: "mymaster"}
+	tests := []struct {
+		name     string
+		replicas []map[string]string
+		want     bool
+	}{
+		{"not listed", []map[string]string{{"ip": "10.0.0.2", "port": "6379", "flags": "slave"}}, false},
+		{"healthy", []map[string]string{{"ip": "10.0.0.1", "port": "6379", "flags": "slave"}}, true},
+		{"down", []map[string]string{{"ip": "10.0.0.1", "port": "6379", "flags": "s_down,slave"}}, false},
+		{"disconnected", []map[string]string{{"ip": "10.0.0.1", "port": "6379", "flags": "slave,disconnected"}}, false},
+		{"other port", []map[string]string{{"ip": "10.0.0.1", "port": "6380", "flags": "slave"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsHealthyReplica(tt.replicas, node); got != tt.want {
+				t.Errorf("IsHealthyReplica() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
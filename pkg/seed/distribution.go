@@ -0,0 +1,64 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// how the sizes (or the numbers of elements) are spread
+type Distribution struct {
+	// fixed, uniform or exp
+	Kind string
+	Min  int
+	Max  int
+	Mean int
+}
+
+// parses "100" (fixed), "100-1000" (uniform) or "exp:1000" (exponential, with that mean)
+// the numbers can have a k or m suffix, for KiB and MiB
+func ParseDistribution(s string) (Distribution, error) {
+	if mean, ok := strings.CutPrefix(s, "exp:"); ok {
+		n, err := parseSize(mean)
+		if err != nil || n <= 0 {
+			return Distribution{}, fmt.Errorf("bad exponential distribution %q", s)
+		}
+		return Distribution{Kind: "exp", Mean: n}, nil
+	}
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		min, err1 := parseSize(lo)
+		max, err2 := parseSize(hi)
+		if err1 != nil || err2 != nil || min < 0 || max < min {
+			return Distribution{}, fmt.Errorf("bad uniform distribution %q", s)
+		}
+		return Distribution{Kind: "uniform", Min: min, Max: max, Mean: (min + max) / 2}, nil
+	}
+	n, err := parseSize(s)
+	if err != nil || n < 0 {
+		return Distribution{}, fmt.Errorf("bad size %q; expected N, MIN-MAX or exp:MEAN", s)
+	}
+	return Distribution{Kind: "fixed", Min: n, Max: n, Mean: n}, nil
+}
+
+func parseSize(s string) (int, error) {
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1024, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1024*1024, strings.TrimSuffix(s, "m")
+	}
+	n, err := strconv.Atoi(s)
+	return n * mult, err
+}
+
+func (d Distribution) Sample(r *rand.Rand) int {
+	switch d.Kind {
+	case "uniform":
+		return d.Min + r.Intn(d.Max-d.Min+1)
+	case "exp":
+		return int(r.ExpFloat64() * float64(d.Mean))
+	}
+	return d.Min
+}
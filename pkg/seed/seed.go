@@ -0,0 +1,300 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// the types of keys to seed
+const (
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeSet    = "set"
+	TypeZSet   = "zset"
+	TypeStream = "stream"
+)
+
+var Types = []string{TypeString, TypeHash, TypeList, TypeSet, TypeZSet, TypeStream}
+
+// parses items like "hash=20", into how often each type is picked, relative to the others
+func ParseTypes(items []string) (map[string]int, error) {
+	weights := map[string]int{}
+	total := 0
+	for _, item := range items {
+		t, weight, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad type %q; expected type=weight", item)
+		}
+		if !slices.Contains(Types, t) {
+			return nil, fmt.Errorf("unknown type %s; expected one of %s", t, strings.Join(Types, ", "))
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bad weight for %s: %q", t, weight)
+		}
+		weights[t] += w
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one type needs a positive weight")
+	}
+	return weights, nil
+}
+
+// writes keys of all types, in batches, from a number of concurrent clients
+type Seeder struct {
+	Client redis.UniversalClient
+	Keys   int
+	Prefix string
+	// type -> weight
+	Types map[string]int
+	// of the strings, and of the elements of the other types
+	ValueSize Distribution
+	// of everything but the strings
+	Elements Distribution
+	// of the keys that expire, between TTL/2 and TTL from now
+	TTLFraction float64
+	TTL         time.Duration
+	// keys per round trip
+	Batch   int
+	Clients int
+
+	written atomic.Int64
+	bytes   atomic.Int64
+	mu      sync.Mutex
+	byType  map[string]int
+}
+
+// how far along the seeding is
+func (s *Seeder) Progress() (keys, bytes int64) {
+	return s.written.Load(), s.bytes.Load()
+}
+
+// how many keys of each type were written
+func (s *Seeder) ByType() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[string]int{}
+	for t, n := range s.byType {
+		res[t] = n
+	}
+	return res
+}
+
+// writes all the keys, replacing the ones already there, until done or the context is
+func (s *Seeder) Run(ctx context.Context) error {
+	s.mu.Lock()
+	s.byType = map[string]int{}
+	s.mu.Unlock()
+	batches := make(chan int)
+	errs := make(chan error, s.Clients)
+	var wg sync.WaitGroup
+	for i := range s.Clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+			for start := range batches {
+				if err := s.writeBatch(ctx, r, start); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	var err error
+feed:
+	for start := 0; start < s.Keys; start += s.Batch {
+		select {
+		case batches <- start:
+		case err = <-errs:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(batches)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
+
+func (s *Seeder) pickType(r *rand.Rand) string {
+	total := 0
+	for _, w := range s.Types {
+		total += w
+	}
+	n := r.Intn(total)
+	for _, t := range Types {
+		n -= s.Types[t]
+		if n < 0 {
+			return t
+		}
+	}
+	return TypeString
+}
+
+func (s *Seeder) writeBatch(ctx context.Context, r *rand.Rand, start int) error {
+	var size int64
+	types := map[string]int{}
+	_, err := s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i := start; i < min(start+s.Batch, s.Keys); i++ {
+			t := s.pickType(r)
+			types[t]++
+			key := fmt.Sprintf("%s%s:%d", s.Prefix, t, i)
+			size += s.write(ctx, p, r, t, key)
+			if r.Float64() < s.TTLFraction {
+				// spread over the second half of the TTL, not to have everything expire at once
+				ttl := s.TTL/2 + time.Duration(r.Int63n(int64(s.TTL/2)+1))
+				p.Expire(ctx, key, ttl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.written.Add(int64(min(s.Batch, s.Keys-start)))
+	s.bytes.Add(size)
+	s.mu.Lock()
+	for t, n := range types {
+		s.byType[t] += n
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// queues the writes of the key, replacing it, and returns roughly how many bytes they are
+func (s *Seeder) write(ctx context.Context, p redis.Pipeliner, r *rand.Rand, t, key string) int64 {
+	if t == TypeString {
+		v := value(r, s.ValueSize.Sample(r))
+		p.Set(ctx, key, v, 0)
+		return int64(len(v))
+	}
+	p.Del(ctx, key)
+	n := max(s.Elements.Sample(r), 1)
+	var size int64
+	switch t {
+	case TypeHash:
+		fields := make([]any, 0, 2*n)
+		for i := range n {
+			v := value(r, s.ValueSize.Sample(r))
+			fields = append(fields, fmt.Sprintf("field:%d", i), v)
+			size += int64(len(v))
+		}
+		p.HSet(ctx, key, fields...)
+	case TypeList:
+		items := make([]any, 0, n)
+		for range n {
+			v := value(r, s.ValueSize.Sample(r))
+			items = append(items, v)
+			size += int64(len(v))
+		}
+		p.RPush(ctx, key, items...)
+	case TypeSet:
+		members := make([]any, 0, n)
+		for i := range n {
+			// prefixed, to be distinct
+			v := fmt.Sprintf("%d:%s", i, value(r, s.ValueSize.Sample(r)))
+			members = append(members, v)
+			size += int64(len(v))
+		}
+		p.SAdd(ctx, key, members...)
+	case TypeZSet:
+		members := make([]redis.Z, 0, n)
+		for i := range n {
+			v := fmt.Sprintf("%d:%s", i, value(r, s.ValueSize.Sample(r)))
+			members = append(members, redis.Z{Score: r.Float64() * 1000, Member: v})
+			size += int64(len(v))
+		}
+		p.ZAdd(ctx, key, members...)
+	case TypeStream:
+		for range n {
+			v := value(r, s.ValueSize.Sample(r))
+			p.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: []any{"value", v}})
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// random letters, so that the values don't compress any better than real ones would
+var pool = func() string {
+	r := rand.New(rand.NewSource(1))
+	b := make([]byte, 1024*1024)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}()
+
+func value(r *rand.Rand, size int) string {
+	if size <= 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.Grow(size)
+	for sb.Len() < size {
+		start := r.Intn(len(pool))
+		sb.WriteString(pool[start:min(len(pool), start+size-sb.Len())])
+	}
+	return sb.String()
+}
+
+// deletes all the keys with the prefix, with SCAN and UNLINK, and returns how many there were
+func Cleanup(ctx context.Context, client *redis.Client, prefix string, batch int) (int64, error) {
+	var deleted int64
+	iter := client.Scan(ctx, 0, matchPrefix(prefix), int64(batch)).Iterator()
+	keys := []string{}
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		n, err := client.Unlink(ctx, keys...).Result()
+		deleted += n
+		keys = keys[:0]
+		return err
+	}
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) >= batch {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	return deleted, flush()
+}
+
+// the SCAN MATCH pattern of the keys starting with the prefix, with its glob characters escaped
+func matchPrefix(prefix string) string {
+	var sb strings.Builder
+	for i := 0; i < len(prefix); i++ {
+		if strings.IndexByte(`\*?[]`, prefix[i]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(prefix[i])
+	}
+	return sb.String() + "*"
+}
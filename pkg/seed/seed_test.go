@@ -0,0 +1,59 @@
+package seed
+
+import "testing"
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Distribution
+		err  bool
+	}{
+		{in: "100", want: Distribution{Kind: "fixed", Min: 100, Max: 100, Mean: 100}},
+		{in: "0", want: Distribution{Kind: "fixed"}},
+		{in: "2k", want: Distribution{Kind: "fixed", Min: 2048, Max: 2048, Mean: 2048}},
+		{in: "1m", want: Distribution{Kind: "fixed", Min: 1 << 20, Max: 1 << 20, Mean: 1 << 20}},
+		{in: "10-20", want: Distribution{Kind: "uniform", Min: 10, Max: 20, Mean: 15}},
+		{in: "1k-2k", want: Distribution{Kind: "uniform", Min: 1024, Max: 2048, Mean: 1536}},
+		{in: "5-5", want: Distribution{Kind: "uniform", Min: 5, Max: 5, Mean: 5}},
+		{in: "exp:1k", want: Distribution{Kind: "exp", Mean: 1024}},
+		{in: "", err: true},
+		{in: "abc", err: true},
+		{in: "-5", err: true},
+		{in: "20-10", err: true},
+		{in: "10-", err: true},
+		{in: "exp:0", err: true},
+		{in: "exp:", err: true},
+		{in: "10g", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDistribution(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("%q: expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"rr:seed:", "rr:seed:*"},
+		{"", "*"},
+		{"a*b?c[d]e", `a\*b\?c\[d\]e*`},
+		{`back\slash`, `back\\slash*`},
+	}
+	for _, tt := range tests {
+		if got := matchPrefix(tt.prefix); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.prefix, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package splitbrain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+)
+
+// a period of time when more than one node claimed to be the master
+type Window struct {
+	Start   time.Time
+	End     time.Time
+	Masters []string
+}
+
+// polls ROLE on every node directly, instead of trusting the sentinel's view
+// while more than one node claims to be the master, it writes a marker key to each of them
+// so that it can later tell how many of the writes on the losing side were discarded
+type Detector struct {
+	Nodes     []*redisClient.RedisInstance
+	KeyPrefix string
+	TTL       time.Duration
+	Interval  time.Duration
+
+	clients map[string]*redis.Client
+	roles   map[string]string
+	mu      sync.Mutex
+	windows []Window
+	// marker keys acknowledged by each node, while it claimed to be the master
+	written map[string][]string
+}
+
+func addr(node *redisClient.RedisInstance) string {
+	return fmt.Sprintf("%s:%s", node.Host, node.Port)
+}
+
+func NewDetector(nodeURL string, nodes []*redisClient.RedisInstance, keyPrefix string, interval time.Duration) (*Detector, error) {
+	d := &Detector{
+		Nodes:     nodes,
+		KeyPrefix: keyPrefix,
+		TTL:       time.Hour,
+		Interval:  interval,
+		clients:   map[string]*redis.Client{},
+		roles:     map[string]string{},
+		written:   map[string][]string{},
+	}
+	for _, node := range nodes {
+		opts, err := redisClient.MakeNodeOptions(nodeURL, node)
+		if err != nil {
+			return nil, err
+		}
+		opts.ReadTimeout = interval
+		opts.WriteTimeout = interval
+		opts.DialTimeout = interval
+		opts.MaxRetries = -1
+		d.clients[addr(node)] = redis.NewClient(opts)
+	}
+	return d, nil
+}
+
+func GetRole(ctx context.Context, rdb *redis.Client) (string, error) {
+	res, err := rdb.Do(ctx, "ROLE").Slice()
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 0 {
+		return "", fmt.Errorf("empty ROLE reply")
+	}
+	role, ok := res[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected ROLE reply %v", res)
+	}
+	return role, nil
+}
+
+// runs until the context is cancelled
+func (d *Detector) Run(ctx context.Context, pq chan map[string]string) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	var window *Window
+	seq := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if window != nil {
+				window.End = time.Now()
+				d.closeWindow(*window, "", pq)
+			}
+			return
+		case <-ticker.C:
+		}
+		masters := d.poll(ctx, pq)
+		if len(masters) > 1 {
+			if window == nil {
+				window = &Window{Start: time.Now(), Masters: masters}
+				pq <- map[string]string{
+					"event":   "split brain",
+					"msg":     strings.Join(masters, " "),
+					"masters": fmt.Sprint(len(masters)),
+				}
+			}
+			for _, m := range masters {
+				if !slices.Contains(window.Masters, m) {
+					window.Masters = append(window.Masters, m)
+				}
+			}
+			seq++
+			d.mark(ctx, masters, seq)
+			continue
+		}
+		if window != nil {
+			window.End = time.Now()
+			winner := ""
+			if len(masters) == 1 {
+				winner = masters[0]
+			}
+			d.closeWindow(*window, winner, pq)
+			window = nil
+		}
+	}
+}
+
+// asks every node for its role, and returns the ones claiming to be the master
+func (d *Detector) poll(ctx context.Context, pq chan map[string]string) []string {
+	masters := []string{}
+	for _, node := range d.Nodes {
+		a := addr(node)
+		role, err := GetRole(ctx, d.clients[a])
+		if err != nil {
+			role = "unreachable"
+		}
+		if d.roles[a] != role {
+			pq <- map[string]string{
+				"event":    "role changed",
+				"msg":      a,
+				"role":     role,
+				"previous": d.roles[a],
+			}
+			d.roles[a] = role
+		}
+		if role == "master" {
+			masters = append(masters, a)
+		}
+	}
+	sort.Strings(masters)
+	return masters
+}
+
+func (d *Detector) mark(ctx context.Context, masters []string, seq int) {
+	for _, m := range masters {
+		key := fmt.Sprintf("%s:%s:%d", d.KeyPrefix, m, seq)
+		if err := d.clients[m].Set(ctx, key, seq, d.TTL).Err(); err != nil {
+			continue
+		}
+		d.mu.Lock()
+		d.written[m] = append(d.written[m], key)
+		d.mu.Unlock()
+	}
+}
+
+func (d *Detector) closeWindow(w Window, winner string, pq chan map[string]string) {
+	d.mu.Lock()
+	d.windows = append(d.windows, w)
+	d.mu.Unlock()
+	pq <- map[string]string{
+		"event":   "split brain healed",
+		"msg":     w.End.Sub(w.Start).String(),
+		"masters": strings.Join(w.Masters, " "),
+		"winner":  winner,
+	}
+}
+
+func (d *Detector) Windows() []Window {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Window{}, d.windows...)
+}
+
+// checks which of the keys acknowledged by the losing masters were discarded when they stepped down
+// the keys were written while the losers were cut off from the winner, so they're only ever on the losers,
+// and they're gone from one once it became a replica, and resynced from the winner
+// the losers still claiming to be the master (or unreachable, or still syncing) are listed apart, their keys not counted
+// call after the split brain is over
+func (d *Detector) Report(ctx context.Context, winner *redisClient.RedisInstance) (map[string]string, error) {
+	windows := d.Windows()
+	var total, longest time.Duration
+	for _, w := range windows {
+		dur := w.End.Sub(w.Start)
+		total += dur
+		if dur > longest {
+			longest = dur
+		}
+	}
+	res := map[string]string{
+		"split_brain_windows":  fmt.Sprint(len(windows)),
+		"split_brain_duration": total.String(),
+		"split_brain_longest":  longest.String(),
+		"winner":               addr(winner),
+	}
+	if len(windows) == 0 {
+		return res, nil
+	}
+	if _, ok := d.clients[addr(winner)]; !ok {
+		return res, fmt.Errorf("winner %s isn't one of the known nodes", addr(winner))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	losers, unconverted := []string{}, []string{}
+	written, discarded := 0, 0
+	for node, keys := range d.written {
+		if node == addr(winner) {
+			continue
+		}
+		losers = append(losers, node)
+		written += len(keys)
+		rdb := d.clients[node]
+		if !synced(ctx, rdb) {
+			unconverted = append(unconverted, node)
+			continue
+		}
+		n, err := rdb.Exists(ctx, keys...).Result()
+		if err != nil {
+			return res, err
+		}
+		discarded += len(keys) - int(n)
+	}
+	sort.Strings(losers)
+	sort.Strings(unconverted)
+	res["losers"] = strings.Join(losers, " ")
+	res["losers_written"] = fmt.Sprint(written)
+	res["losers_discarded"] = fmt.Sprint(discarded)
+	res["losers_not_converted"] = strings.Join(unconverted, " ")
+	return res, nil
+}
+
+// whether the node is a replica, done syncing with its master
+func synced(ctx context.Context, rdb *redis.Client) bool {
+	role, err := GetRole(ctx, rdb)
+	if err != nil || role != "slave" {
+		return false
+	}
+	info, err := redisClient.GetReplicationInfo(ctx, rdb)
+	return err == nil && info["master_link_status"] == "up"
+}
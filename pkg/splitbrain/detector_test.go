@@ -0,0 +1,297 @@
+package splitbrain
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seeker89/redis-resiliency-toolkit/pkg/redisClient"
+)
+
+// just enough of a redis node for the detector: ROLE, INFO replication, SET and EXISTS
+type fakeNode struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+	role  string
+	link  string
+	keys  map[string]bool
+}
+
+func newFakeNode(t *testing.T, role string) *fakeNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNode{ln: ln, role: role, link: "up", keys: map[string]bool{}}
+	t.Cleanup(f.stop)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// down, along with the connections already open
+func (f *fakeNode) stop() {
+	f.ln.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.conns {
+		c.Close()
+	}
+}
+
+func (f *fakeNode) instance() *redisClient.RedisInstance {
+	host, port, _ := net.SplitHostPort(f.ln.Addr().String())
+	return &redisClient.RedisInstance{Host: host, Port: port, Master: "mymaster"}
+}
+
+func (f *fakeNode) addr() string {
+	return addr(f.instance())
+}
+
+func (f *fakeNode) set(role, link string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.role, f.link = role, link
+}
+
+func (f *fakeNode) markers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := []string{}
+	for k := range f.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// like a full resync from the winner, which never had the markers
+func (f *fakeNode) flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = map[string]bool{}
+}
+
+func (f *fakeNode) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write([]byte(f.reply(args))); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeNode) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "ROLE":
+		return fmt.Sprintf("*1\r\n$%d\r\n%s\r\n", len(f.role), f.role)
+	case "INFO":
+		info := "# Replication\r\nrole:" + f.role + "\r\n"
+		if f.role == "slave" {
+			info += "master_link_status:" + f.link + "\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(info), info)
+	case "SET":
+		f.keys[args[1]] = true
+		return "+OK\r\n"
+	case "EXISTS":
+		n := 0
+		for _, k := range args[1:] {
+			if f.keys[k] {
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "CLIENT", "PING":
+		return "+OK\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// a RESP array of bulk strings, which is how the clients send the commands
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func newTestDetector(t *testing.T, nodes ...*fakeNode) *Detector {
+	instances := []*redisClient.RedisInstance{}
+	for _, n := range nodes {
+		instances = append(instances, n.instance())
+	}
+	d, err := NewDetector("", instances, "rr:split-brain", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func waitForEvent(t *testing.T, pq chan map[string]string, event string) map[string]string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-pq:
+			if e["event"] == event {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", event)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	a, b, c := newFakeNode(t, "master"), newFakeNode(t, "master"), newFakeNode(t, "slave")
+	d := newTestDetector(t, a, b, c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pq := make(chan map[string]string, 100)
+	stopped := make(chan bool)
+	go func() {
+		d.Run(ctx, pq)
+		close(stopped)
+	}()
+
+	// two masters from the start
+	e := waitForEvent(t, pq, "split brain")
+	if e["masters"] != "2" {
+		t.Errorf("expected 2 masters, got %v", e)
+	}
+	waitFor(t, "the markers", func() bool { return len(a.markers()) > 0 && len(b.markers()) > 0 })
+	if len(c.markers()) > 0 {
+		t.Errorf("marked the replica: %v", c.markers())
+	}
+
+	// healed, with a winner
+	b.set("slave", "up")
+	e = waitForEvent(t, pq, "split brain healed")
+	if e["winner"] != a.addr() {
+		t.Errorf("expected the winner %s, got %v", a.addr(), e)
+	}
+	windows := d.Windows()
+	if len(windows) != 1 {
+		t.Fatalf("expected a window, got %v", windows)
+	}
+	if w := windows[0]; len(w.Masters) != 2 || !w.End.After(w.Start) {
+		t.Errorf("unexpected window %+v", w)
+	}
+
+	// split again, and stopped before it healed
+	c.set("master", "")
+	waitForEvent(t, pq, "split brain")
+	cancel()
+	e = waitForEvent(t, pq, "split brain healed")
+	if e["winner"] != "" {
+		t.Errorf("expected no winner, got %v", e)
+	}
+	<-stopped
+	if windows := d.Windows(); len(windows) != 2 {
+		t.Errorf("expected 2 windows, got %v", windows)
+	}
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name string
+		// what happened to the loser after the split brain
+		loser       func(f *fakeNode)
+		discarded   string
+		unconverted bool
+	}{
+		{"resynced from the winner", func(f *fakeNode) { f.set("slave", "up"); f.flush() }, "3", false},
+		{"a replica keeping its data", func(f *fakeNode) { f.set("slave", "up") }, "0", false},
+		{"still syncing", func(f *fakeNode) { f.set("slave", "down"); f.flush() }, "0", true},
+		{"still the master", func(f *fakeNode) {}, "0", true},
+		{"unreachable", func(f *fakeNode) { f.set("slave", "up"); f.flush(); f.stop() }, "0", true},
+	}
+	for _, tt := range tests {
+		winner, loser := newFakeNode(t, "master"), newFakeNode(t, "master")
+		d := newTestDetector(t, winner, loser)
+		start := time.Now()
+		d.windows = []Window{{Start: start, End: start.Add(time.Second), Masters: []string{winner.addr(), loser.addr()}}}
+		for seq := 1; seq <= 3; seq++ {
+			d.mark(context.Background(), []string{winner.addr(), loser.addr()}, seq)
+		}
+		tt.loser(loser)
+		res, err := d.Report(context.Background(), winner.instance())
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if res["losers"] != loser.addr() || res["losers_written"] != "3" || res["split_brain_windows"] != "1" || res["split_brain_longest"] != "1s" {
+			t.Errorf("%s: unexpected report %v", tt.name, res)
+		}
+		if res["losers_discarded"] != tt.discarded {
+			t.Errorf("%s: expected %s discarded, got %s", tt.name, tt.discarded, res["losers_discarded"])
+		}
+		if (res["losers_not_converted"] == loser.addr()) != tt.unconverted {
+			t.Errorf("%s: expected not converted %v, got %q", tt.name, tt.unconverted, res["losers_not_converted"])
+		}
+	}
+}
+
+func TestReportWithoutSplitBrain(t *testing.T) {
+	a := newFakeNode(t, "master")
+	d := newTestDetector(t, a)
+	res, err := d.Report(context.Background(), a.instance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["split_brain_windows"] != "0" || res["losers"] != "" {
+		t.Errorf("unexpected report %v", res)
+	}
+	d.windows = []Window{{}}
+	if _, err := d.Report(context.Background(), &redisClient.RedisInstance{Host: "10.0.0.1", Port: "6379"}); err == nil {
+		t.Errorf("expected an error for an unknown winner")
+	}
+}
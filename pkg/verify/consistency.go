@@ -0,0 +1,420 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// how the values are compared
+const (
+	// a hash of the contents, read by type (GET, HGETALL, SMEMBERS, ZRANGE, LRANGE, XRANGE), with the unordered ones sorted,
+	// so that it only depends on the contents; the types it doesn't know (like the modules') are dumped
+	DigestContent = "content"
+	// a hash of the serialized value, without the RDB version and the checksum at the end,
+	// so that nodes of different versions compare; an encoding converted on one node and not the other still differs
+	DigestDump = "dump"
+	// DEBUG DIGEST-VALUE, which only depends on the contents, but needs enable-debug-command
+	DigestDebug = "debug"
+)
+
+var Digests = []string{DigestContent, DigestDump, DigestDebug}
+
+// how a key on a replica differs from the master
+const (
+	Missing  = "missing"
+	Extra    = "extra"
+	Mismatch = "mismatch"
+)
+
+type Node struct {
+	Name   string
+	Client *redis.Client
+}
+
+// the type and the digest of the value of every key, by key
+type Snapshot map[string]string
+
+// a key still differing after all the rechecks
+type Discrepancy struct {
+	Key  string
+	Kind string
+	// the type and the digest on each, empty when missing
+	Master  string
+	Replica string
+}
+
+type ReplicaResult struct {
+	Name string
+	Keys int
+	// sorted by key
+	Discrepancies []Discrepancy
+	// the keys found differing by the scan, and then the same by a recheck
+	Resolved int
+	Err      error
+}
+
+func (r *ReplicaResult) Count(kind string) int {
+	n := 0
+	for _, d := range r.Discrepancies {
+		if d.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+type Result struct {
+	MasterKeys int
+	Replicas   []*ReplicaResult
+}
+
+func (r *Result) Consistent() bool {
+	for _, rr := range r.Replicas {
+		if rr.Err != nil || len(rr.Discrepancies) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compares the keyspace of the replicas with the master's
+// the writes in flight make the scans differ, so whatever differs is read again from both,
+// after an interval, a number of times, and only what differs every time is reported
+type Verifier struct {
+	Master   *Node
+	Replicas []*Node
+	// the same SCAN, with the same MATCH and COUNT, on every node
+	Match  string
+	Count  int
+	Digest string
+	// how many times to read the differing keys again, and how long to wait before each
+	Rechecks        int
+	RecheckInterval time.Duration
+	// called when a node is scanned, and after every recheck of a replica, with how many keys still differ
+	OnScanned func(node string, keys int)
+	OnRecheck func(replica string, pass, remaining int)
+}
+
+// scans all the nodes at the same time, to keep the writes in between to a minimum, and then rechecks each replica
+// an error scanning the master fails it all, while one scanning a replica is only that replica's
+func (v *Verifier) Run(ctx context.Context) (*Result, error) {
+	nodes := append([]*Node{v.Master}, v.Replicas...)
+	snapshots := make([]Snapshot, len(nodes))
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshots[i], errs[i] = v.Scan(ctx, n.Client)
+			if errs[i] == nil && v.OnScanned != nil {
+				v.OnScanned(n.Name, len(snapshots[i]))
+			}
+		}()
+	}
+	wg.Wait()
+	if errs[0] != nil {
+		return nil, fmt.Errorf("scanning the master %s: %w", v.Master.Name, errs[0])
+	}
+	res := &Result{MasterKeys: len(snapshots[0])}
+	for i, n := range v.Replicas {
+		rr := &ReplicaResult{Name: n.Name, Err: errs[i+1]}
+		res.Replicas = append(res.Replicas, rr)
+		if rr.Err != nil {
+			continue
+		}
+		rr.Keys = len(snapshots[i+1])
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.recheck(ctx, n, rr, Compare(snapshots[0], snapshots[i+1]))
+		}()
+	}
+	wg.Wait()
+	return res, nil
+}
+
+// the keys that differ, and how
+func Compare(master, replica Snapshot) map[string]string {
+	diff := map[string]string{}
+	for k, m := range master {
+		r, ok := replica[k]
+		switch {
+		case !ok:
+			diff[k] = Missing
+		case r != m:
+			diff[k] = Mismatch
+		}
+	}
+	for k := range replica {
+		if _, ok := master[k]; !ok {
+			diff[k] = Extra
+		}
+	}
+	return diff
+}
+
+// reads the differing keys again from both, dropping the ones that converged
+func (v *Verifier) recheck(ctx context.Context, replica *Node, rr *ReplicaResult, diff map[string]string) {
+	found := len(diff)
+	var master, current Snapshot
+	for pass := 1; pass <= v.Rechecks && len(diff) > 0; pass++ {
+		select {
+		case <-ctx.Done():
+			rr.Err = ctx.Err()
+			return
+		case <-time.After(v.RecheckInterval):
+		}
+		keys := []string{}
+		for k := range diff {
+			keys = append(keys, k)
+		}
+		var err error
+		if master, err = v.digests(ctx, v.Master.Client, keys); err != nil {
+			rr.Err = fmt.Errorf("rechecking the master: %w", err)
+			return
+		}
+		if current, err = v.digests(ctx, replica.Client, keys); err != nil {
+			rr.Err = fmt.Errorf("rechecking: %w", err)
+			return
+		}
+		diff = Compare(master, current)
+		if v.OnRecheck != nil {
+			v.OnRecheck(replica.Name, pass, len(diff))
+		}
+	}
+	rr.Resolved = found - len(diff)
+	for k, kind := range diff {
+		d := Discrepancy{Key: k, Kind: kind}
+		// without a recheck, there's only the kind
+		if master != nil {
+			d.Master, d.Replica = master[k], current[k]
+		}
+		rr.Discrepancies = append(rr.Discrepancies, d)
+	}
+	slices.SortFunc(rr.Discrepancies, func(a, b Discrepancy) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+}
+
+// scans the keys matching the pattern, and digests them a page at a time
+// a key can come up more than once in a SCAN, which only overwrites it
+func (v *Verifier) Scan(ctx context.Context, client *redis.Client) (Snapshot, error) {
+	snapshot := Snapshot{}
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, v.Match, int64(v.Count)).Result()
+		if err != nil {
+			return nil, err
+		}
+		digests, err := v.digests(ctx, client, keys)
+		if err != nil {
+			return nil, err
+		}
+		for k, d := range digests {
+			snapshot[k] = d
+		}
+		if next == 0 {
+			return snapshot, nil
+		}
+		cursor = next
+	}
+}
+
+// the type and the digest of each of the keys, in a pipeline
+// the keys gone meanwhile, or expired on a replica, are left out
+func (v *Verifier) digests(ctx context.Context, client *redis.Client, keys []string) (Snapshot, error) {
+	res := Snapshot{}
+	for start := 0; start < len(keys); start += v.Count {
+		batch := keys[start:min(start+v.Count, len(keys))]
+		if v.Digest == DigestContent {
+			if err := contents(ctx, client, batch, res); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		types := make([]*redis.StatusCmd, len(batch))
+		values := make([]redis.Cmder, len(batch))
+		_, err := client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			for i, k := range batch {
+				types[i] = p.Type(ctx, k)
+				if v.Digest == DigestDebug {
+					values[i] = p.Do(ctx, "debug", "digest-value", k)
+				} else {
+					values[i] = p.Dump(ctx, k)
+				}
+			}
+			return nil
+		})
+		// a key gone between the TYPE and the DUMP is a nil, which is no error here
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, k := range batch {
+			t := types[i].Val()
+			if t == "none" {
+				continue
+			}
+			digest, err := digest(values[i])
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			res[k] = t + ":" + digest
+		}
+	}
+	return res, nil
+}
+
+func digest(cmd redis.Cmder) (string, error) {
+	switch c := cmd.(type) {
+	case *redis.StringCmd:
+		dump, err := c.Result()
+		if err != nil {
+			return "", err
+		}
+		// the RDB version (2 bytes) and the CRC64 (8 bytes)
+		if len(dump) >= 10 {
+			dump = dump[:len(dump)-10]
+		}
+		sum := sha256.Sum256([]byte(dump))
+		return hex.EncodeToString(sum[:16]), nil
+	case *redis.Cmd:
+		digests, err := c.StringSlice()
+		if err != nil {
+			return "", err
+		}
+		if len(digests) != 1 {
+			return "", fmt.Errorf("unexpected reply to DEBUG DIGEST-VALUE: %v", digests)
+		}
+		return digests[0], nil
+	}
+	return "", fmt.Errorf("unexpected command %s", cmd.Name())
+}
+
+// the type of each of the keys first, and then their contents, read the way each type is, in two pipelines
+// the keys gone meanwhile, or of another type by then, are left out, to be read again by a recheck
+func contents(ctx context.Context, client *redis.Client, keys []string, res Snapshot) error {
+	types := make([]*redis.StatusCmd, len(keys))
+	_, err := client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, k := range keys {
+			types[i] = p.Type(ctx, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	values := make([]redis.Cmder, len(keys))
+	_, err = client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, k := range keys {
+			switch types[i].Val() {
+			case "none":
+			case "string":
+				values[i] = p.Get(ctx, k)
+			case "hash":
+				values[i] = p.HGetAll(ctx, k)
+			case "set":
+				values[i] = p.SMembers(ctx, k)
+			case "zset":
+				values[i] = p.ZRangeWithScores(ctx, k, 0, -1)
+			case "list":
+				values[i] = p.LRange(ctx, k, 0, -1)
+			case "stream":
+				values[i] = p.XRange(ctx, k, "-", "+")
+			default:
+				values[i] = p.Dump(ctx, k)
+			}
+		}
+		return nil
+	})
+	// checked key by key below
+	if err != nil && err != redis.Nil && !isWrongType(err) {
+		return err
+	}
+	for i, k := range keys {
+		if values[i] == nil {
+			continue
+		}
+		t := types[i].Val()
+		digest, err := contentDigest(t, values[i])
+		if err == redis.Nil || isWrongType(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		res[k] = t + ":" + digest
+	}
+	return nil
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// a hash of the contents read for the type, the same whatever order the unordered ones come in
+func contentDigest(t string, cmd redis.Cmder) (string, error) {
+	if err := cmd.Err(); err != nil {
+		return "", err
+	}
+	parts := []string{}
+	switch c := cmd.(type) {
+	case *redis.StringCmd:
+		if t != "string" {
+			return digest(c)
+		}
+		parts = append(parts, c.Val())
+	case *redis.MapStringStringCmd:
+		fields := make([]string, 0, len(c.Val()))
+		for f := range c.Val() {
+			fields = append(fields, f)
+		}
+		slices.Sort(fields)
+		for _, f := range fields {
+			parts = append(parts, f, c.Val()[f])
+		}
+	case *redis.StringSliceCmd:
+		parts = slices.Clone(c.Val())
+		if t == "set" {
+			slices.Sort(parts)
+		}
+	case *redis.ZSliceCmd:
+		// by score, and then by member, on every node
+		for _, z := range c.Val() {
+			parts = append(parts, fmt.Sprint(z.Member), strconv.FormatFloat(z.Score, 'g', -1, 64))
+		}
+	case *redis.XMessageSliceCmd:
+		// the fields of each entry come as a map, so they're sorted too
+		for _, m := range c.Val() {
+			fields := make([]string, 0, len(m.Values))
+			for f := range m.Values {
+				fields = append(fields, f)
+			}
+			slices.Sort(fields)
+			parts = append(parts, m.ID, strconv.Itoa(len(fields)))
+			for _, f := range fields {
+				parts = append(parts, f, fmt.Sprint(m.Values[f]))
+			}
+		}
+	default:
+		return "", fmt.Errorf("unexpected command %s", cmd.Name())
+	}
+	h := sha256.New()
+	for _, p := range parts {
+		// length-prefixed, so that no two lists of parts hash the same
+		fmt.Fprintf(h, "%d:%s", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
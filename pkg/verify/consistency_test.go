@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		master  Snapshot
+		replica Snapshot
+		want    map[string]string
+	}{
+		{"both empty", Snapshot{}, Snapshot{}, map[string]string{}},
+		{"the same", Snapshot{"a": "string:1", "b": "hash:2"}, Snapshot{"a": "string:1", "b": "hash:2"}, map[string]string{}},
+		{"missing", Snapshot{"a": "string:1", "b": "hash:2"}, Snapshot{"a": "string:1"}, map[string]string{"b": Missing}},
+		{"extra", Snapshot{"a": "string:1"}, Snapshot{"a": "string:1", "c": "set:3"}, map[string]string{"c": Extra}},
+		{"another value", Snapshot{"a": "string:1"}, Snapshot{"a": "string:2"}, map[string]string{"a": Mismatch}},
+		{"another type", Snapshot{"a": "string:1"}, Snapshot{"a": "list:1"}, map[string]string{"a": Mismatch}},
+		{"empty replica", Snapshot{"a": "string:1", "b": "hash:2"}, Snapshot{}, map[string]string{"a": Missing, "b": Missing}},
+		{"empty master", nil, Snapshot{"a": "string:1"}, map[string]string{"a": Extra}},
+		{
+			"all at once",
+			Snapshot{"a": "string:1", "b": "hash:2", "c": "zset:3"},
+			Snapshot{"a": "string:1", "b": "hash:x", "d": "set:4"},
+			map[string]string{"b": Mismatch, "c": Missing, "d": Extra},
+		},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.master, tt.replica); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestContentDigest(t *testing.T) {
+	stream := func(fields map[string]interface{}) redis.Cmder {
+		return redis.NewXMessageSliceCmdResult([]redis.XMessage{{ID: "1-0", Values: fields}}, nil)
+	}
+	tests := []struct {
+		name string
+		t    string
+		a, b redis.Cmder
+		same bool
+	}{
+		{"string", "string", redis.NewStringResult("v", nil), redis.NewStringResult("v", nil), true},
+		{"another string", "string", redis.NewStringResult("v", nil), redis.NewStringResult("w", nil), false},
+		{"set in another order", "set", redis.NewStringSliceResult([]string{"a", "b", "c"}, nil), redis.NewStringSliceResult([]string{"c", "a", "b"}, nil), true},
+		{"list in another order", "list", redis.NewStringSliceResult([]string{"a", "b", "c"}, nil), redis.NewStringSliceResult([]string{"c", "a", "b"}, nil), false},
+		{"parts joined differently", "list", redis.NewStringSliceResult([]string{"ab", "c"}, nil), redis.NewStringSliceResult([]string{"a", "bc"}, nil), false},
+		{"hash", "hash", redis.NewMapStringStringResult(map[string]string{"f": "1", "g": "2"}, nil), redis.NewMapStringStringResult(map[string]string{"g": "2", "f": "1"}, nil), true},
+		{"another hash", "hash", redis.NewMapStringStringResult(map[string]string{"f": "1", "g": "2"}, nil), redis.NewMapStringStringResult(map[string]string{"f": "2", "g": "1"}, nil), false},
+		{"zset", "zset", redis.NewZSliceCmdResult([]redis.Z{{Member: "a", Score: 1}}, nil), redis.NewZSliceCmdResult([]redis.Z{{Member: "a", Score: 1}}, nil), true},
+		{"another score", "zset", redis.NewZSliceCmdResult([]redis.Z{{Member: "a", Score: 1}}, nil), redis.NewZSliceCmdResult([]redis.Z{{Member: "a", Score: 1.5}}, nil), false},
+		{"stream", "stream", stream(map[string]interface{}{"f": "1", "g": "2"}), stream(map[string]interface{}{"g": "2", "f": "1"}), true},
+		{"another stream", "stream", stream(map[string]interface{}{"f": "1"}), stream(map[string]interface{}{"f": "2"}), false},
+	}
+	for _, tt := range tests {
+		a, err1 := contentDigest(tt.t, tt.a)
+		b, err2 := contentDigest(tt.t, tt.b)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("%s: %v, %v", tt.name, err1, err2)
+		}
+		if (a == b) != tt.same {
+			t.Errorf("%s: expected the same digest %v, got %s and %s", tt.name, tt.same, a, b)
+		}
+	}
+	if _, err := contentDigest("string", redis.NewStringResult("", redis.Nil)); err != redis.Nil {
+		t.Errorf("expected redis.Nil for a key gone, got %v", err)
+	}
+	if _, err := contentDigest("hash", redis.NewMapStringStringResult(nil, errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"))); !isWrongType(err) {
+		t.Errorf("expected WRONGTYPE for a key of another type by then, got %v", err)
+	}
+}